@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/ariefro/buycut-api/internal/asset"
+	"github.com/ariefro/buycut-api/internal/initializer"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	log.SetLevel(log.InfoLevel)
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+}
+
+// reconcile compares the stored images with the database and prints the differences as JSON
+func main() {
+	deleteOrphans := flag.Bool("delete-orphans", false, "delete the assets no company or brand references")
+	flagBroken := flag.Bool("flag-broken", false, "set image_missing on rows referencing missing assets")
+	minAge := flag.Duration("min-age", asset.DefaultMinOrphanAge, "only delete orphans older than this")
+	flag.Parse()
+
+	report, err := initializer.InitializedAssetService().Reconcile(context.Background(), &asset.ReconcileArgs{
+		DeleteOrphans: *deleteOrphans,
+		FlagBroken:    *flagBroken,
+		MinAge:        *minAge,
+	})
+	if err != nil {
+		log.Fatalf("failed to reconcile assets: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("failed to print report: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -10,12 +11,43 @@ import (
 type Config struct {
 	AppPort       string `mapstructure:"APP_PORT"`
 	ClientBaseURL string `mapstructure:"CLIENT_BASE_URL"`
+	// RequestTimeout bounds the database and storage calls made for a request
+	RequestTimeout time.Duration `mapstructure:"REQUEST_TIMEOUT"`
 
 	CloudinaryApiKey       string `mapstructure:"CLOUDINARY_API_KEY"`
 	CloudinaryBuycutFolder string `mapstructure:"CLOUDINARY_BUYCUT_FOLDER"`
 	CloudinaryCloudName    string `mapstructure:"CLOUDINARY_CLOUD_NAME"`
 	CloudinarySecretKey    string `mapstructure:"CLOUDINARY_SECRET_KEY"`
 
+	StorageDriver       string `mapstructure:"STORAGE_DRIVER"`
+	LocalStorageDir     string `mapstructure:"LOCAL_STORAGE_DIR"`
+	LocalStorageBaseURL string `mapstructure:"LOCAL_STORAGE_BASE_URL"`
+
+	S3Endpoint      string `mapstructure:"S3_ENDPOINT"`
+	S3AccessKey     string `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey     string `mapstructure:"S3_SECRET_KEY"`
+	S3Bucket        string `mapstructure:"S3_BUCKET"`
+	S3Region        string `mapstructure:"S3_REGION"`
+	S3UseSSL        bool   `mapstructure:"S3_USE_SSL"`
+	S3PublicBaseURL string `mapstructure:"S3_PUBLIC_BASE_URL"`
+
+	StorageTimeout      time.Duration `mapstructure:"STORAGE_TIMEOUT"`
+	StorageMaxRetries   int           `mapstructure:"STORAGE_MAX_RETRIES"`
+	StorageRetryBackoff time.Duration `mapstructure:"STORAGE_RETRY_BACKOFF"`
+
+	// AssetReconcileCron schedules the reconciliation of stored images with the database, empty disables it
+	AssetReconcileCron string `mapstructure:"ASSET_RECONCILE_CRON"`
+
+	CompanyImageMaxSizeKB uint `mapstructure:"COMPANY_IMAGE_MAX_SIZE_KB"`
+	CompanyImageMaxWidth  uint `mapstructure:"COMPANY_IMAGE_MAX_WIDTH"`
+	CompanyImageMaxHeight uint `mapstructure:"COMPANY_IMAGE_MAX_HEIGHT"`
+	CompanyImageMaxPixels uint `mapstructure:"COMPANY_IMAGE_MAX_PIXELS"`
+	BrandImageMaxSizeKB   uint `mapstructure:"BRAND_IMAGE_MAX_SIZE_KB"`
+	BrandImageMaxWidth    uint `mapstructure:"BRAND_IMAGE_MAX_WIDTH"`
+	BrandImageMaxHeight   uint `mapstructure:"BRAND_IMAGE_MAX_HEIGHT"`
+	BrandImageMaxPixels   uint `mapstructure:"BRAND_IMAGE_MAX_PIXELS"`
+	SVGRasterize          bool `mapstructure:"SVG_RASTERIZE"`
+
 	JwtAccessTokenSecret   string `mapstructure:"JWT_SECRET_KEY"`
 	JwtAccessTokenDuration uint   `mapstructure:"JWT_ACCESS_TOKEN_DURATION"`
 
@@ -36,6 +68,32 @@ func NewLoadConfig() *Config {
 
 	viper.AutomaticEnv()
 
+	// defaults also let viper pick these keys up from the environment when the file leaves them out
+	viper.SetDefault("REQUEST_TIMEOUT", "60s")
+	viper.SetDefault("STORAGE_DRIVER", "cloudinary")
+	viper.SetDefault("LOCAL_STORAGE_DIR", "./uploads")
+	viper.SetDefault("LOCAL_STORAGE_BASE_URL", "/uploads")
+	viper.SetDefault("S3_ENDPOINT", "")
+	viper.SetDefault("S3_ACCESS_KEY", "")
+	viper.SetDefault("S3_SECRET_KEY", "")
+	viper.SetDefault("S3_BUCKET", "")
+	viper.SetDefault("S3_REGION", "")
+	viper.SetDefault("S3_USE_SSL", false)
+	viper.SetDefault("S3_PUBLIC_BASE_URL", "")
+	viper.SetDefault("STORAGE_TIMEOUT", "30s")
+	viper.SetDefault("STORAGE_MAX_RETRIES", 2)
+	viper.SetDefault("STORAGE_RETRY_BACKOFF", "200ms")
+	viper.SetDefault("ASSET_RECONCILE_CRON", "")
+	viper.SetDefault("COMPANY_IMAGE_MAX_SIZE_KB", 1024)
+	viper.SetDefault("COMPANY_IMAGE_MAX_WIDTH", 2048)
+	viper.SetDefault("COMPANY_IMAGE_MAX_HEIGHT", 2048)
+	viper.SetDefault("COMPANY_IMAGE_MAX_PIXELS", 4000000)
+	viper.SetDefault("BRAND_IMAGE_MAX_SIZE_KB", 1024)
+	viper.SetDefault("BRAND_IMAGE_MAX_WIDTH", 2048)
+	viper.SetDefault("BRAND_IMAGE_MAX_HEIGHT", 2048)
+	viper.SetDefault("BRAND_IMAGE_MAX_PIXELS", 4000000)
+	viper.SetDefault("SVG_RASTERIZE", true)
+
 	err := viper.ReadInConfig()
 	if err != nil {
 		log.Fatalf("failed to read config: %v", err)
@@ -0,0 +1,33 @@
+package config
+
+// ImageLimits bounds the images uploaded for one kind of entity
+type ImageLimits struct {
+	MaxSizeKB uint
+	MaxWidth  uint
+	MaxHeight uint
+	// MaxPixels is checked against the header before an image is decoded, so a small file
+	// that expands into a huge bitmap is turned away without being decompressed
+	MaxPixels uint
+	// RasterizeSVG stores PNG variants next to a sanitized SVG for clients that cannot render one
+	RasterizeSVG bool
+}
+
+func (c *Config) CompanyImageLimits() *ImageLimits {
+	return &ImageLimits{
+		MaxSizeKB:    c.CompanyImageMaxSizeKB,
+		MaxWidth:     c.CompanyImageMaxWidth,
+		MaxHeight:    c.CompanyImageMaxHeight,
+		MaxPixels:    c.CompanyImageMaxPixels,
+		RasterizeSVG: c.SVGRasterize,
+	}
+}
+
+func (c *Config) BrandImageLimits() *ImageLimits {
+	return &ImageLimits{
+		MaxSizeKB:    c.BrandImageMaxSizeKB,
+		MaxWidth:     c.BrandImageMaxWidth,
+		MaxHeight:    c.BrandImageMaxHeight,
+		MaxPixels:    c.BrandImageMaxPixels,
+		RasterizeSVG: c.SVGRasterize,
+	}
+}
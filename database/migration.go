@@ -1,18 +1,120 @@
 package database
 
 import (
+	"fmt"
+
 	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/pkg/helper"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 func Migration(db *gorm.DB) {
 	log.Info("running migrations...")
+	// pg_trgm powers the typo-tolerant name search, unaccent the full-text search
+	db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm")
+	db.Exec("CREATE EXTENSION IF NOT EXISTS unaccent")
+
 	db.AutoMigrate(
 		&entity.Company{},
 		&entity.Brand{},
+		&entity.BrandOwnership{},
 		&entity.User{},
+		&entity.SearchTerm{},
+		&entity.SearchQueryStat{},
 	)
 
+	// register the primary company of existing brands as their owner
+	db.Exec(`INSERT INTO brand_ownerships (brand_id, company_id, role, created_at, updated_at)
+		SELECT b.id, b.company_id, ?, NOW(), NOW() FROM brands b
+		WHERE NOT EXISTS (SELECT 1 FROM brand_ownerships bo WHERE bo.brand_id = b.id)`, entity.OwnershipRoleOwner)
+
+	// names are matched through the keys of their search terms, these trigram indexes went unused
+	db.Exec("DROP INDEX IF EXISTS idx_companies_name_trgm")
+	db.Exec("DROP INDEX IF EXISTS idx_brands_name_trgm")
+
+	// domain and barcode lookups match against any element of these arrays
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_companies_domains ON companies USING gin (domains)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_companies_barcode_prefixes ON companies USING gin (barcode_prefixes)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_brands_domains ON brands USING gin (domains)")
+
+	migrateFullTextSearch(db)
+	migrateSearchTerms(db)
+	migrateImages(db)
+
 	log.Info("migrations complete...")
 }
+
+// migrateImages keeps the single image uploaded before images had sized variants as their original
+func migrateImages(db *gorm.DB) {
+	for _, model := range []interface{}{&entity.Company{}, &entity.Brand{}} {
+		if !db.Migrator().HasColumn(model, "image_url") {
+			continue
+		}
+
+		db.Model(model).Where("image_url <> '' AND images = '{}'").
+			Update("images", gorm.Expr("jsonb_build_object(?::text, image_url)", entity.ImageOriginal))
+		db.Migrator().DropColumn(model, "image_url")
+	}
+}
+
+// migrateFullTextSearch maintains a weighted tsvector over names, aliases and descriptions.
+// Names weigh the most, then aliases, then descriptions.
+func migrateFullTextSearch(db *gorm.DB) {
+	db.Exec(`DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'buycut_indonesian') THEN
+				CREATE TEXT SEARCH CONFIGURATION buycut_indonesian (COPY = pg_catalog.indonesian);
+				ALTER TEXT SEARCH CONFIGURATION buycut_indonesian
+					ALTER MAPPING FOR hword, hword_part, word WITH unaccent, indonesian_stem;
+			END IF;
+		END
+	$$`)
+
+	db.Exec(`CREATE OR REPLACE FUNCTION buycut_search_document(name text, aliases text[], description text)
+		RETURNS tsvector LANGUAGE sql IMMUTABLE AS $$
+			SELECT setweight(to_tsvector('buycut_indonesian', COALESCE(name, '')), 'A') ||
+				setweight(to_tsvector('buycut_indonesian', COALESCE(array_to_string(aliases, ' '), '')), 'B') ||
+				setweight(to_tsvector('buycut_indonesian', COALESCE(description, '')), 'C')
+		$$`)
+
+	for _, table := range []string{"companies", "brands"} {
+		db.Exec(fmt.Sprintf(`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (buycut_search_document(name, aliases, description)) STORED`, table))
+		db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_search_vector ON %[1]s USING gin (search_vector)", table))
+	}
+}
+
+// migrateSearchTerms indexes the lookup keys of names and aliases for exact, prefix and similarity
+// queries, registers the names and aliases that existed before the terms table and normalizes the
+// keys stored before they were normalized
+func migrateSearchTerms(db *gorm.DB) {
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_search_terms_key ON search_terms (key text_pattern_ops)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_search_terms_key_trgm ON search_terms USING gin (key gin_trgm_ops)")
+
+	for _, table := range []struct{ name, column string }{{"companies", "company_id"}, {"brands", "brand_id"}} {
+		db.Exec(fmt.Sprintf(`INSERT INTO search_terms (%[2]s, term, key, alias)
+			SELECT t.id, TRIM(t.term), LOWER(TRIM(t.term)), t.alias FROM (
+				SELECT id, name AS term, false AS alias FROM %[1]s
+				UNION
+				SELECT id, UNNEST(aliases) AS term, true AS alias FROM %[1]s
+			) t
+			WHERE TRIM(t.term) <> '' AND NOT EXISTS (SELECT 1 FROM search_terms st WHERE st.%[2]s = t.id)`, table.name, table.column))
+	}
+
+	// the keys are normalized in Go, so rows inserted above and older rows are fixed up here
+	var terms []*entity.SearchTerm
+	if err := db.Model(&entity.SearchTerm{}).Select("id", "term", "key").FindInBatches(&terms, 500, func(tx *gorm.DB, batch int) error {
+		for _, term := range terms {
+			if key := helper.NormalizeSearchKey(term.Term); key != term.Key {
+				if err := tx.Model(&entity.SearchTerm{}).Where("id = ?", term.ID).Update("key", key).Error; err != nil {
+					log.Errorln("failed to normalize search term key:", err)
+				}
+			}
+		}
+
+		return nil
+	}).Error; err != nil {
+		log.Errorln("failed to normalize search term keys:", err)
+	}
+}
@@ -0,0 +1,35 @@
+package asset
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	log "github.com/sirupsen/logrus"
+)
+
+// ScheduleReconcile runs the reconciliation on the cron schedule, an empty schedule disables it.
+// The job only reports and flags broken references, orphans are deleted by the reconcile command.
+func ScheduleReconcile(schedule string, service Service) error {
+	if schedule == "" {
+		return nil
+	}
+
+	scheduler := gocron.NewScheduler(time.UTC)
+	scheduler.SingletonModeAll()
+	if _, err := scheduler.Cron(schedule).Do(func() {
+		report, err := service.Reconcile(context.Background(), &ReconcileArgs{FlagBroken: true, MinAge: DefaultMinOrphanAge})
+		if err != nil {
+			log.Errorln("failed to reconcile assets:", err)
+			return
+		}
+
+		log.Infof("reconciled %d assets with %d image references: %d orphaned, %d broken",
+			report.Assets, report.References, len(report.Orphans), len(report.Broken))
+	}); err != nil {
+		return err
+	}
+
+	scheduler.StartAsync()
+	return nil
+}
@@ -0,0 +1,57 @@
+package asset
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	FindImageReferences(ctx context.Context) ([]*imageReference, error)
+	FlagMissingImages(ctx context.Context, companyIDs, brandIDs []int64) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) FindImageReferences(ctx context.Context) ([]*imageReference, error) {
+	var references []*imageReference
+	err := r.db.WithContext(ctx).Raw(`SELECT @company AS type, id, images FROM companies
+		UNION ALL
+		SELECT @brand AS type, id, images FROM brands`,
+		sql.Named("company", sourceCompany),
+		sql.Named("brand", sourceBrand),
+	).Scan(&references).Error
+
+	return references, err
+}
+
+// FlagMissingImages flags the given rows and clears the flag of every other row, rows already
+// flagged the right way are left untouched
+func (r *repository) FlagMissingImages(ctx context.Context, companyIDs, brandIDs []int64) error {
+	// a nil array binds as NULL, which would compare as unknown and never clear a flag
+	if companyIDs == nil {
+		companyIDs = []int64{}
+	}
+
+	if brandIDs == nil {
+		brandIDs = []int64{}
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE companies SET image_missing = (id = ANY(CAST(@ids AS bigint[])))
+			WHERE image_missing <> (id = ANY(CAST(@ids AS bigint[])))`, sql.Named("ids", pq.Int64Array(companyIDs))).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`UPDATE brands SET image_missing = (id = ANY(CAST(@ids AS bigint[])))
+			WHERE image_missing <> (id = ANY(CAST(@ids AS bigint[])))`, sql.Named("ids", pq.Int64Array(brandIDs))).Error
+	})
+}
@@ -0,0 +1,156 @@
+package asset
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ariefro/buycut-api/internal/cloudstorage"
+	"github.com/ariefro/buycut-api/internal/entity"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sourceCompany = "company"
+	sourceBrand   = "brand"
+)
+
+// DefaultMinOrphanAge keeps the assets of uploads still in progress from being taken for orphans
+const DefaultMinOrphanAge = time.Hour
+
+type Service interface {
+	Reconcile(ctx context.Context, args *ReconcileArgs) (*Report, error)
+}
+
+type service struct {
+	repo    Repository
+	storage cloudstorage.Storage
+}
+
+func NewService(repo Repository, storage cloudstorage.Storage) Service {
+	return &service{repo, storage}
+}
+
+type ReconcileArgs struct {
+	// DeleteOrphans deletes the assets no row references once they are older than MinAge
+	DeleteOrphans bool
+	// FlagBroken sets image_missing on the rows referencing an asset the storage does not have
+	FlagBroken bool
+	MinAge     time.Duration
+}
+
+type Report struct {
+	Assets         int                `json:"assets"`
+	References     int                `json:"references"`
+	Orphans        []*Orphan          `json:"orphans"`
+	Broken         []*BrokenReference `json:"broken"`
+	DeletedOrphans int                `json:"deleted_orphans"`
+	FlaggedRows    int                `json:"flagged_rows"`
+}
+
+// Orphan is an asset in the storage that no company or brand references
+type Orphan struct {
+	*cloudstorage.Asset
+	Deleted bool `json:"deleted"`
+}
+
+// BrokenReference is an image URL of a company or brand that points to nothing in the storage
+type BrokenReference struct {
+	Type    string `json:"type"` // Either "company" or "brand"
+	ID      uint   `json:"id"`
+	Variant string `json:"variant"`
+	URL     string `json:"url"`
+}
+
+type imageReference struct {
+	Type   string
+	ID     uint
+	Images entity.Images
+}
+
+// Reconcile compares the assets in the storage with the image URLs stored in the database
+func (s *service) Reconcile(ctx context.Context, args *ReconcileArgs) (*Report, error) {
+	// read the rows first, an asset uploaded in between is then at worst a recent orphan
+	references, err := s.repo.FindImageReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	assets, err := s.storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(assets))
+	for _, asset := range assets {
+		stored[asset.Key()] = false
+	}
+
+	report := &Report{Assets: len(assets), Orphans: []*Orphan{}, Broken: []*BrokenReference{}}
+	var companyIDs, brandIDs []int64
+	for _, reference := range references {
+		broken := false
+		for _, variant := range sortedVariants(reference.Images) {
+			url := reference.Images[variant]
+			report.References++
+
+			asset, ok := s.storage.Locate(url)
+			if ok {
+				_, ok = stored[asset.Key()]
+			}
+
+			if !ok {
+				broken = true
+				report.Broken = append(report.Broken, &BrokenReference{Type: reference.Type, ID: reference.ID, Variant: variant, URL: url})
+				continue
+			}
+
+			stored[asset.Key()] = true
+		}
+
+		if broken && reference.Type == sourceCompany {
+			companyIDs = append(companyIDs, int64(reference.ID))
+		} else if broken {
+			brandIDs = append(brandIDs, int64(reference.ID))
+		}
+	}
+
+	cutoff := time.Now().Add(-args.MinAge)
+	for _, asset := range assets {
+		if stored[asset.Key()] {
+			continue
+		}
+
+		orphan := &Orphan{Asset: asset}
+		if args.DeleteOrphans && asset.UpdatedAt.Before(cutoff) {
+			if err := s.storage.Delete(ctx, &cloudstorage.DeleteArgs{CompanyID: asset.CompanyID, Slug: asset.Slug}); err != nil {
+				log.Errorf("failed to delete orphaned asset %s: %v", asset.Key(), err)
+			} else {
+				orphan.Deleted = true
+				report.DeletedOrphans++
+			}
+		}
+
+		report.Orphans = append(report.Orphans, orphan)
+	}
+
+	if args.FlagBroken {
+		if err := s.repo.FlagMissingImages(ctx, companyIDs, brandIDs); err != nil {
+			return nil, err
+		}
+
+		report.FlaggedRows = len(companyIDs) + len(brandIDs)
+	}
+
+	return report, nil
+}
+
+func sortedVariants(images entity.Images) []string {
+	variants := make([]string, 0, len(images))
+	for variant := range images {
+		variants = append(variants, variant)
+	}
+	sort.Strings(variants)
+
+	return variants
+}
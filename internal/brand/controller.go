@@ -2,9 +2,11 @@ package brand
 
 import (
 	"mime/multipart"
+	"time"
 
 	"github.com/ariefro/buycut-api/internal/company"
 	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/pkg/common"
 	"github.com/ariefro/buycut-api/pkg/helper"
 	"github.com/ariefro/buycut-api/pkg/pagination"
 	"github.com/gofiber/fiber/v2"
@@ -15,8 +17,18 @@ type Controller interface {
 	Create(c *fiber.Ctx) error
 	FindByKeyword(c *fiber.Ctx) error
 	FindAll(c *fiber.Ctx) error
+	Find(c *fiber.Ctx) error
+	FindOneByID(c *fiber.Ctx) error
 	Update(c *fiber.Ctx) error
 	Delete(c *fiber.Ctx) error
+	PresignImageUpload(c *fiber.Ctx) error
+	FinalizeImageUpload(c *fiber.Ctx) error
+	FindOwnerships(c *fiber.Ctx) error
+	CreateOwnership(c *fiber.Ctx) error
+	UpdateOwnership(c *fiber.Ctx) error
+	DeleteOwnership(c *fiber.Ctx) error
+	LookupBatch(c *fiber.Ctx) error
+	Scan(c *fiber.Ctx) error
 }
 
 type controller struct {
@@ -29,12 +41,51 @@ func NewController(service Service, companyService company.Service) Controller {
 }
 
 type getBrandByKeywordRequest struct {
-	Keyword string `json:"keyword" validate:"min(3)~Silakan masukkan setidaknya 3 karakter untuk melakukan pencarian"`
+	Keyword string `json:"keyword" query:"keyword" validate:"min(3)~Silakan masukkan setidaknya 3 karakter untuk melakukan pencarian"`
+	Date    string `json:"date" query:"date"`
+	// The facet filters take comma separated values, e.g. "company,brand"
+	Type     string `json:"type" query:"type"`
+	Category string `json:"category" query:"category"`
+	Country  string `json:"country" query:"country"`
+	Status   string `json:"status" query:"status"` // Defaults to "boycotted"
+}
+
+type getBoycottedArgs struct {
+	Keyword    string
+	At         time.Time
+	Types      []string
+	Categories []string
+	Countries  []string
+	Statuses   []string
+}
+
+type getBrandsRequest struct {
+	CompanyID   uint   `query:"company_id"`
+	Category    string `query:"category"`
+	CreatedFrom string `query:"created_from"`
+	CreatedTo   string `query:"created_to"`
+	Sort        string `query:"sort"`
+}
+
+type getBrandsArgs struct {
+	CompanyID   uint
+	Category    string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Sort        pagination.Sort
 }
 
 type createBrandsRequest struct {
-	CompanyID uint   `form:"company_id" validate:"required~company id tidak boleh kosong"`
-	Name      string `form:"name" validate:"required~nama merek tidak boleh kosong"`
+	CompanyID   uint     `form:"company_id" validate:"required~company id tidak boleh kosong"`
+	Name        string   `form:"name" validate:"required~nama merek tidak boleh kosong"`
+	Role        string   `form:"role"`
+	Category    string   `form:"category"`
+	Description string   `form:"description"`
+	Proof       []string `form:"proof"`
+	Aliases     []string `form:"aliases"`
+	Domains     []string `form:"domains"`
+	// ImageSourceURL is fetched by the server when no image file is uploaded
+	ImageSourceURL string `form:"image_source_url"`
 }
 
 type createBrandArgs struct {
@@ -44,8 +95,17 @@ type createBrandArgs struct {
 }
 
 type updateBrandsRequest struct {
-	Name      string `form:"name" validate:"required~nama merek tidak boleh kosong"`
-	CompanyID *uint  `form:"company_id"`
+	Name          string   `form:"name" validate:"required~nama merek tidak boleh kosong"`
+	CompanyID     *uint    `form:"company_id"`
+	Category      *string  `form:"category"`
+	Description   *string  `form:"description"`
+	Proof         []string `form:"proof"`
+	Aliases       []string `form:"aliases"`
+	Domains       []string `form:"domains"`
+	TransferredAt string   `form:"transferred_at"`
+	SourceURL     string   `form:"source_url"`
+	// ImageSourceURL is fetched by the server when no image file is uploaded
+	ImageSourceURL string `form:"image_source_url"`
 }
 
 type updateBrandArgs struct {
@@ -54,20 +114,98 @@ type updateBrandArgs struct {
 	FormHeader *multipart.FileHeader
 }
 
+type brandOwnershipRequest struct {
+	CompanyID uint     `json:"company_id" validate:"required~company id tidak boleh kosong"`
+	Role      string   `json:"role" validate:"required~peran kepemilikan tidak boleh kosong"`
+	Stake     *float64 `json:"stake"`
+	StartedAt string   `json:"started_at"`
+	EndedAt   string   `json:"ended_at"`
+	SourceURL string   `json:"source_url"`
+}
+
+type transferPrimaryOwnerArgs struct {
+	BrandID       uint
+	OldCompanyID  uint
+	NewCompanyID  uint
+	TransferredAt time.Time
+	SourceURL     string
+}
+
 type boycottedResult struct {
-	ID          uint            `json:"id"`
-	Name        string          `json:"name"`
-	Slug        string          `json:"slug"`
-	Description string          `json:"description"`
-	ImageURL    string          `json:"image_url"`
-	Proof       []string        `json:"proof"`
-	Company     *entity.Company `json:"company"`
-	Type        string          `json:"type"` // Either "company" or "brand"
+	ID           uint                    `json:"id"`
+	Name         string                  `json:"name"`
+	Slug         string                  `json:"slug"`
+	Description  string                  `json:"description"`
+	Descriptions []*sourcedText          `json:"descriptions"`
+	Images       entity.Images           `json:"images"`
+	Proof        []string                `json:"proof"`
+	Proofs       []*sourcedText          `json:"proofs"`
+	Company      *entity.Company         `json:"company"`
+	Owners       []entity.BrandOwnership `json:"owners,omitempty"`
+	Type         string                  `json:"type"` // Either "company" or "brand"
+	Highlight    string                  `json:"highlight,omitempty"`
+	Status       string                  `json:"status,omitempty"`     // Either "boycotted" or "cleared"
+	MatchType    string                  `json:"match_type,omitempty"` // Either "exact", "alias", "prefix", "fuzzy" or "description"
+	Score        float64                 `json:"score"`                // From 0 to 1, how well the result matches the keyword
+}
+
+// sourcedText is a piece of description or proof along with where it came from
+type sourcedText struct {
+	Text   string `json:"text"`
+	Source string `json:"source"` // Either "company" or "brand"
+}
+
+type lookupBatchRequest struct {
+	Items []string `json:"items"` // Names, barcodes or domains
+	Date  string   `json:"date"`
+}
+
+// lookupKeys are the normalized keys of a lookup batch, grouped by what they are matched against
+type lookupKeys struct {
+	Names    []string
+	Domains  []string
+	Barcodes []string
+}
+
+// lookupKey is a key a lookup item is matched by, along with what kind of key it is
+type lookupKey struct {
+	Kind string
+	Key  string
+}
+
+type lookupResult struct {
+	Input      string             `json:"input"`
+	Kind       string             `json:"kind"`    // Either "name", "domain" or "barcode"
+	Verdict    string             `json:"verdict"` // Either "boycotted", "not_boycotted", "not_found" or "ambiguous"
+	Match      *boycottedResult   `json:"match,omitempty"`
+	Candidates []*boycottedResult `json:"candidates,omitempty"`
+}
+
+type scanRequest struct {
+	Text string `json:"text"` // A receipt, a product title or a chat message
+	Date string `json:"date"`
+}
+
+// scanMention is a boycotted company or brand mentioned in a scanned text, Start and End are character offsets
+type scanMention struct {
+	Text  string           `json:"text"`
+	Start int              `json:"start"`
+	End   int              `json:"end"`
+	Match *boycottedResult `json:"match"`
 }
 
-type boycottedCountResult struct {
-	CompanyCount int64 `json:"company_count"`
-	BrandCount   int64 `json:"brand_count"`
+// boycottedFacets counts the results by each facet. The counts of a facet apply every filter
+// except the facet's own, so clients can show how many results the other values would give.
+type boycottedFacets struct {
+	Type     []*facetCount `json:"type"`
+	Category []*facetCount `json:"category"`
+	Country  []*facetCount `json:"country"`
+	Status   []*facetCount `json:"status"`
+}
+
+type facetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
 }
 
 func (ctrl *controller) Create(c *fiber.Ctx) error {
@@ -82,18 +220,18 @@ func (ctrl *controller) Create(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	company, err := ctrl.companyService.FindOneByID(c.Context(), request.CompanyID)
+	company, err := ctrl.companyService.FindOneByID(c.UserContext(), request.CompanyID)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
 	formHeader, err := c.FormFile("image")
-	if err != nil {
+	if err != nil && request.ImageSourceURL == "" {
 		response := helper.ResponseFailed("Image file is required")
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	if err := ctrl.service.Create(c.Context(), &createBrandArgs{
+	if err := ctrl.service.Create(c.UserContext(), &createBrandArgs{
 		CompanyID:  company.ID,
 		FormHeader: formHeader,
 		Request:    &request,
@@ -105,15 +243,31 @@ func (ctrl *controller) Create(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(res)
 }
 
+// parseKeywordRequest reads the keyword from the query string of GET requests and from the body otherwise
+func parseKeywordRequest(c *fiber.Ctx, request *getBrandByKeywordRequest) error {
+	if c.Method() == fiber.MethodGet {
+		return c.QueryParser(request)
+	}
+
+	return c.BodyParser(request)
+}
+
 func (ctrl *controller) FindByKeyword(c *fiber.Ctx) error {
 	var request getBrandByKeywordRequest
-	if err := c.BodyParser(&request); err != nil {
+	if err := parseKeywordRequest(c, &request); err != nil {
 		response := helper.ResponseFailed(err.Error())
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	result, err := ctrl.service.FindByKeyword(c.Context(), &request)
+	result, err := ctrl.service.FindByKeyword(c.UserContext(), &request)
 	if err != nil {
+		if err.Error() == common.BrandNotFound {
+			if suggestion, _ := ctrl.service.Suggest(c.UserContext(), request.Keyword); suggestion != "" {
+				res := helper.ResponseFailedWithSuggestion(err.Error(), suggestion)
+				return c.Status(fiber.StatusNotFound).JSON(res)
+			}
+		}
+
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
@@ -123,7 +277,7 @@ func (ctrl *controller) FindByKeyword(c *fiber.Ctx) error {
 
 func (ctrl *controller) FindAll(c *fiber.Ctx) error {
 	var request getBrandByKeywordRequest
-	if err := c.BodyParser(&request); err != nil {
+	if err := parseKeywordRequest(c, &request); err != nil {
 		res := helper.ResponseFailed(err.Error())
 		return c.Status(fiber.StatusBadRequest).JSON(res)
 	}
@@ -133,7 +287,64 @@ func (ctrl *controller) FindAll(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	count, err := ctrl.service.CountAll(c.Context(), &request)
+	args, err := ctrl.service.ParseBoycottedArgs(&request)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	count, facets, err := ctrl.service.CountFacets(c.UserContext(), args)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	pages := pagination.NewFromRequest(c, int(count))
+	paginationParams := pagination.PaginationParams{
+		Offset: pages.Offset(),
+		Limit:  pages.Size(),
+	}
+
+	// count a search once, not again for every page the user turns
+	if pages.CurrentPage == 1 {
+		ctrl.service.RecordSearch(args.Keyword, count)
+	}
+
+	results, err := ctrl.service.FindAll(c.UserContext(), args, &paginationParams)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccessWithFacets("Berhasil memuat daftar merek yang diboikot", results, pages, facets)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) Find(c *fiber.Ctx) error {
+	var request getBrandsRequest
+	if err := c.QueryParser(&request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	args, err := ctrl.service.ParseFindArgs(&request)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	if pagination.IsCursorRequest(c) {
+		cursorParams, err := pagination.NewCursorFromRequest(c)
+		if err != nil {
+			return helper.GenerateErrorResponse(c, err.Error())
+		}
+
+		results, pages, err := ctrl.service.FindByCursor(c.UserContext(), args, cursorParams)
+		if err != nil {
+			return helper.GenerateErrorResponse(c, err.Error())
+		}
+
+		res := helper.ResponseSuccessWithCursor("Berhasil memuat daftar merek", results, pages)
+		return c.Status(fiber.StatusOK).JSON(res)
+	}
+
+	count, err := ctrl.service.Count(c.UserContext(), args)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
@@ -144,16 +355,31 @@ func (ctrl *controller) FindAll(c *fiber.Ctx) error {
 		Limit:  pages.Size(),
 	}
 
-	results, err := ctrl.service.FindAll(c.Context(), &request, &paginationParams)
+	results, err := ctrl.service.Find(c.UserContext(), args, &paginationParams)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccessWithPagination("Berhasil memuat daftar merek", results, pages)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) FindOneByID(c *fiber.Ctx) error {
+	brandID := helper.ParseStringToUint(c.Params("id"))
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
-	// adjust pages data
-	pages.Limit = pages.Limit * 2
-	pages.LastPage = (int(count) + pages.Limit - 1) / pages.Limit
+	result := newBrandResult(brand)
+	result.Status = brandStatusAt(brand, time.Now())
+
+	message := "Merek ini tidak lagi masuk dalam daftar boikot"
+	if result.Status == statusBoycotted {
+		message = "Merek ini masuk dalam daftar boikot!"
+	}
 
-	res := helper.ResponseSuccessWithPagination("Berhasil memuat daftar merek yang diboikot", results, pages)
+	res := helper.ResponseSuccess(message, result)
 	return c.Status(fiber.StatusOK).JSON(res)
 }
 
@@ -170,13 +396,13 @@ func (ctrl *controller) Update(c *fiber.Ctx) error {
 	}
 
 	brandID := helper.ParseStringToUint(c.Params("id"))
-	brand, err := ctrl.service.FindOneByID(c.Context(), brandID)
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
 	formHeader, _ := c.FormFile("image")
-	if err := ctrl.service.Update(c.Context(), brandID, &updateBrandArgs{
+	if err := ctrl.service.Update(c.UserContext(), brandID, &updateBrandArgs{
 		Brand:      brand,
 		Request:    &request,
 		FormHeader: formHeader,
@@ -190,15 +416,163 @@ func (ctrl *controller) Update(c *fiber.Ctx) error {
 
 func (ctrl *controller) Delete(c *fiber.Ctx) error {
 	brandID := helper.ParseStringToUint(c.Params("id"))
-	brand, err := ctrl.service.FindOneByID(c.Context(), brandID)
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
-	if err := ctrl.service.Delete(c.Context(), brand); err != nil {
+	if err := ctrl.service.Delete(c.UserContext(), brand); err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
 	res := helper.ResponseSuccess("Berhasil menghapus merek dari daftar boikot", nil)
 	return c.Status(fiber.StatusOK).JSON(res)
 }
+
+func (ctrl *controller) PresignImageUpload(c *fiber.Ctx) error {
+	brandID := helper.ParseStringToUint(c.Params("id"))
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	upload, err := ctrl.service.PresignImageUpload(c.UserContext(), brand)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Silakan unggah gambar ke alamat berikut", upload)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) FinalizeImageUpload(c *fiber.Ctx) error {
+	brandID := helper.ParseStringToUint(c.Params("id"))
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	images, err := ctrl.service.FinalizeImageUpload(c.UserContext(), brand)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil menyimpan gambar", images)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) FindOwnerships(c *fiber.Ctx) error {
+	brandID := helper.ParseStringToUint(c.Params("id"))
+	if _, err := ctrl.service.FindOneByID(c.UserContext(), brandID); err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	ownerships, err := ctrl.service.FindOwnerships(c.UserContext(), brandID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil memuat riwayat kepemilikan merek", ownerships)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) CreateOwnership(c *fiber.Ctx) error {
+	var request brandOwnershipRequest
+	if err := c.BodyParser(&request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	if err := validator.ValidateStruct(request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	brandID := helper.ParseStringToUint(c.Params("id"))
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	if err := ctrl.service.CreateOwnership(c.UserContext(), brand, &request); err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil menambahkan kepemilikan merek", nil)
+	return c.Status(fiber.StatusCreated).JSON(res)
+}
+
+func (ctrl *controller) UpdateOwnership(c *fiber.Ctx) error {
+	var request brandOwnershipRequest
+	if err := c.BodyParser(&request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	if err := validator.ValidateStruct(request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	brandID := helper.ParseStringToUint(c.Params("id"))
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	ownershipID := helper.ParseStringToUint(c.Params("ownershipId"))
+	if err := ctrl.service.UpdateOwnership(c.UserContext(), brand, ownershipID, &request); err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil memperbarui kepemilikan merek", nil)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) DeleteOwnership(c *fiber.Ctx) error {
+	brandID := helper.ParseStringToUint(c.Params("id"))
+	brand, err := ctrl.service.FindOneByID(c.UserContext(), brandID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	ownershipID := helper.ParseStringToUint(c.Params("ownershipId"))
+	if err := ctrl.service.DeleteOwnership(c.UserContext(), brand, ownershipID); err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil menghapus kepemilikan merek", nil)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) LookupBatch(c *fiber.Ctx) error {
+	var request lookupBatchRequest
+	if err := c.BodyParser(&request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	results, err := ctrl.service.LookupBatch(c.UserContext(), &request)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil memeriksa daftar belanja", results)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) Scan(c *fiber.Ctx) error {
+	var request scanRequest
+	if err := c.BodyParser(&request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	results, err := ctrl.service.Scan(c.UserContext(), &request)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil memindai teks", results)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
@@ -2,21 +2,40 @@ package brand
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/internal/search"
 	"github.com/ariefro/buycut-api/pkg/common"
+	"github.com/ariefro/buycut-api/pkg/helper"
 	"github.com/ariefro/buycut-api/pkg/pagination"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
 type Repository interface {
 	Create(ctx context.Context, brands *entity.Brand) error
-	FindByKeyword(ctx context.Context, keyword string) ([]*entity.Company, []*entity.Brand, error)
+	FindByKeyword(ctx context.Context, keyword string, at time.Time) ([]*entity.Company, []*entity.Brand, error)
+	FindClosestName(ctx context.Context, keyword string) (string, error)
 	FindOneByID(ctx context.Context, brandID uint) (*entity.Brand, error)
-	FindAll(ctx context.Context, args *getBrandByKeywordRequest, paginationParams *pagination.PaginationParams) ([]*entity.Company, []*entity.Brand, error)
-	CountBrands(ctx context.Context, keyword string) (int64, error)
-	Update(ctx context.Context, brandID uint, data map[string]interface{}) error
+	FindAll(ctx context.Context, args *getBoycottedArgs, paginationParams *pagination.PaginationParams) ([]*boycottedMatch, error)
+	CountFacets(ctx context.Context, args *getBoycottedArgs) ([]*facetRow, error)
+	FindLookupMatches(ctx context.Context, keys *lookupKeys, at time.Time) ([]*lookupMatch, error)
+	ResolveLookupMatches(ctx context.Context, matches []*lookupMatch, at time.Time) error
+	Count(ctx context.Context, args *getBrandsArgs) (int64, error)
+	Find(ctx context.Context, args *getBrandsArgs, paginationParams *pagination.PaginationParams) ([]*entity.Brand, error)
+	FindByCursor(ctx context.Context, args *getBrandsArgs, cursorParams *pagination.CursorParams) ([]*entity.Brand, error)
+	UpdateInTx(ctx context.Context, tx *gorm.DB, brandID uint, data map[string]interface{}) error
+	TransferPrimaryOwnerInTx(ctx context.Context, tx *gorm.DB, args *transferPrimaryOwnerArgs) error
+	FindOwnerships(ctx context.Context, brandID uint) ([]*entity.BrandOwnership, error)
+	FindOneOwnership(ctx context.Context, brandID, ownershipID uint) (*entity.BrandOwnership, error)
+	CreateOwnership(ctx context.Context, ownership *entity.BrandOwnership) error
+	UpdateOwnership(ctx context.Context, ownershipID uint, data map[string]interface{}) error
+	DeleteOwnership(ctx context.Context, ownershipID uint) error
 	Delete(ctx context.Context, brandID uint) error
 }
 
@@ -36,26 +55,51 @@ func (r *repository) Create(ctx context.Context, brands *entity.Brand) error {
 	return nil
 }
 
-func (r *repository) FindByKeyword(ctx context.Context, keyword string) ([]*entity.Company, []*entity.Brand, error) {
+func (r *repository) FindByKeyword(ctx context.Context, keyword string, at time.Time) ([]*entity.Company, []*entity.Brand, error) {
 	var companies []*entity.Company
 	var brands []*entity.Brand
 
+	key := search.TermKey(keyword)
+
 	// Search in companies
-	if err := r.db.WithContext(ctx).Model(&entity.Company{}).Preload("Brands").Where("LOWER(name) = LOWER(?)", keyword).Find(&companies).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entity.Company{}).Preload("Brands").
+		Where("EXISTS (SELECT 1 FROM search_terms st WHERE st.company_id = companies.id AND NOT st.alias AND st.key = ?)", key).
+		Find(&companies).Error; err != nil {
 		return nil, nil, err
 	}
 
 	// Search in brands
-	if err := r.db.WithContext(ctx).Model(&entity.Brand{}).Preload("Company").Where("LOWER(name) = LOWER(?)", keyword).Find(&brands).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entity.Brand{}).Scopes(boycottedBrandsAt(at)).Preload("Company").Preload("Owners", activeOwnershipsAt(at)).Preload("Owners.Company").
+		Where("EXISTS (SELECT 1 FROM search_terms st WHERE st.brand_id = brands.id AND NOT st.alias AND st.key = ?)", key).
+		Find(&brands).Error; err != nil {
 		return nil, nil, err
 	}
 
 	return companies, brands, nil
 }
 
+func (r *repository) FindClosestName(ctx context.Context, keyword string) (string, error) {
+	var names []string
+	if err := r.db.WithContext(ctx).Raw(`SELECT COALESCE(c.name, b.name) AS name
+		FROM search_terms st
+		LEFT JOIN companies c ON c.id = st.company_id
+		LEFT JOIN brands b ON b.id = st.brand_id
+		WHERE st.key % @key
+		ORDER BY similarity(st.key, @key) DESC, name ASC LIMIT 1`, sql.Named("key", search.TermKey(keyword))).
+		Scan(&names).Error; err != nil {
+		return "", err
+	}
+
+	if len(names) == 0 {
+		return "", nil
+	}
+
+	return names[0], nil
+}
+
 func (r *repository) FindOneByID(ctx context.Context, brandID uint) (*entity.Brand, error) {
 	var brand *entity.Brand
-	if err := r.db.WithContext(ctx).Model(&entity.Brand{}).Preload("Company").First(&brand, "id = ?", brandID).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&entity.Brand{}).Preload("Company").Preload("Owners", orderOwnerships).Preload("Owners.Company").First(&brand, "id = ?", brandID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New(common.BrandNotFound)
 		}
@@ -66,40 +110,271 @@ func (r *repository) FindOneByID(ctx context.Context, brandID uint) (*entity.Bra
 	return brand, nil
 }
 
-func (r *repository) FindAll(ctx context.Context, args *getBrandByKeywordRequest, paginationParams *pagination.PaginationParams) ([]*entity.Company, []*entity.Brand, error) {
-	var companies []*entity.Company
-	var brands []*entity.Brand
-	keyword := "%" + args.Keyword + "%"
+// boycottedMatch is a row of the boycotted feed, which lists companies and brands together
+type boycottedMatch struct {
+	Type           string
+	ID             uint
+	Name           string
+	Status         string
+	MatchType      string
+	SearchScore    float64
+	SearchHeadline string
+	Company        *entity.Company `gorm:"-"`
+	Brand          *entity.Brand   `gorm:"-"`
+}
 
-	// Search in companies
-	resultCompanies := r.db.WithContext(ctx).Model(&entity.Company{}).Limit(paginationParams.Limit).Offset(paginationParams.Offset).Where("LOWER(name) LIKE LOWER(?)", keyword).Order("name asc").Find(&companies)
-	if resultCompanies.Error != nil {
-		return nil, nil, resultCompanies.Error
+func (r *repository) FindAll(ctx context.Context, args *getBoycottedArgs, paginationParams *pagination.PaginationParams) ([]*boycottedMatch, error) {
+	var matches []*boycottedMatch
+	query := "SELECT * FROM (" + boycottedFeedQuery(args.Keyword) + ") feed WHERE " + facetCondition(args, "") +
+		" ORDER BY search_score DESC, name ASC, type ASC, id ASC LIMIT @limit OFFSET @offset"
+	if err := r.db.WithContext(ctx).Raw(query, boycottedFeedArgs(args,
+		sql.Named("limit", paginationParams.Limit),
+		sql.Named("offset", paginationParams.Offset),
+	)...).Scan(&matches).Error; err != nil {
+		return nil, err
 	}
 
-	// Calculate limit for loading brands
-	queryLimitBrand := calculateQueryLimitBrand(resultCompanies.RowsAffected, paginationParams.Limit)
+	var companyIDs, brandIDs []uint
+	for _, match := range matches {
+		if match.Type == sourceCompany {
+			companyIDs = append(companyIDs, match.ID)
+		} else {
+			brandIDs = append(brandIDs, match.ID)
+		}
+	}
 
-	// Search in brands
-	resultBrands := r.db.WithContext(ctx).Model(&entity.Brand{}).Preload("Company").Limit(int(queryLimitBrand)).Offset(paginationParams.Offset).Where("LOWER(name) LIKE LOWER(?)", keyword).Order("name asc").Find(&brands)
-	if resultBrands.Error != nil {
-		return nil, nil, resultBrands.Error
+	companies, brands, err := r.findByIDs(ctx, companyIDs, brandIDs, args.At)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range matches {
+		match.Company = companies[match.ID]
+		if match.Type == sourceBrand {
+			match.Company = nil
+			match.Brand = brands[match.ID]
+		}
+	}
+
+	return matches, nil
+}
+
+// findByIDs loads the given companies and brands keyed by id, brands with the ownerships active on the given date
+func (r *repository) findByIDs(ctx context.Context, companyIDs, brandIDs []uint, at time.Time) (map[uint]*entity.Company, map[uint]*entity.Brand, error) {
+	companies := map[uint]*entity.Company{}
+	if len(companyIDs) > 0 {
+		var rows []*entity.Company
+		if err := r.db.WithContext(ctx).Model(&entity.Company{}).Where("id IN ?", companyIDs).Find(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+
+		for _, company := range rows {
+			companies[company.ID] = company
+		}
+	}
+
+	brands := map[uint]*entity.Brand{}
+	if len(brandIDs) > 0 {
+		var rows []*entity.Brand
+		if err := r.db.WithContext(ctx).Model(&entity.Brand{}).Preload("Company").Preload("Owners", activeOwnershipsAt(at)).Preload("Owners.Company").Where("id IN ?", brandIDs).Find(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+
+		for _, brand := range rows {
+			brands[brand.ID] = brand
+		}
 	}
 
 	return companies, brands, nil
 }
 
-func (r *repository) CountBrands(ctx context.Context, keyword string) (int64, error) {
+// lookupMatch is a company or brand whose name, alias, domain or barcode prefix equals one of the lookup keys,
+// or whose name or alias is mentioned in a scanned text
+type lookupMatch struct {
+	Kind      string
+	Key       string
+	CompanyID *uint
+	BrandID   *uint
+	Alias     bool
+	Company   *entity.Company `gorm:"-"`
+	Brand     *entity.Brand   `gorm:"-"`
+	Boycotted bool            `gorm:"-"`
+}
+
+// FindLookupMatches resolves all keys of a batch at once, one query for the matches and one per entity type to load them
+func (r *repository) FindLookupMatches(ctx context.Context, keys *lookupKeys, at time.Time) ([]*lookupMatch, error) {
+	var matches []*lookupMatch
+	if err := r.db.WithContext(ctx).Raw(`SELECT 'name' AS kind, st.key, st.company_id, st.brand_id, st.alias
+			FROM search_terms st WHERE st.key = ANY(CAST(@names AS text[]))
+		UNION ALL
+		SELECT 'domain', d.value, c.id, NULL, false
+			FROM companies c CROSS JOIN LATERAL UNNEST(c.domains) AS d(value)
+			WHERE c.domains && CAST(@domains AS text[]) AND d.value = ANY(CAST(@domains AS text[]))
+		UNION ALL
+		SELECT 'domain', d.value, NULL, b.id, false
+			FROM brands b CROSS JOIN LATERAL UNNEST(b.domains) AS d(value)
+			WHERE b.domains && CAST(@domains AS text[]) AND d.value = ANY(CAST(@domains AS text[]))
+		UNION ALL
+		SELECT 'barcode', p.value, c.id, NULL, false
+			FROM companies c CROSS JOIN LATERAL UNNEST(c.barcode_prefixes) AS p(value)
+			WHERE c.barcode_prefixes && CAST(@barcodes AS text[]) AND p.value = ANY(CAST(@barcodes AS text[]))`,
+		sql.Named("names", pq.StringArray(keys.Names)),
+		sql.Named("domains", pq.StringArray(keys.Domains)),
+		sql.Named("barcodes", pq.StringArray(keys.Barcodes)),
+	).Scan(&matches).Error; err != nil {
+		return nil, err
+	}
+
+	if err := r.ResolveLookupMatches(ctx, matches, at); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// ResolveLookupMatches loads the company or brand of every match and whether it is boycotted on the given date
+func (r *repository) ResolveLookupMatches(ctx context.Context, matches []*lookupMatch, at time.Time) error {
+	var companyIDs, brandIDs []uint
+	for _, match := range matches {
+		if match.CompanyID != nil {
+			companyIDs = append(companyIDs, *match.CompanyID)
+		} else if match.BrandID != nil {
+			brandIDs = append(brandIDs, *match.BrandID)
+		}
+	}
+
+	companies, brands, err := r.findByIDs(ctx, companyIDs, brandIDs, at)
+	if err != nil {
+		return err
+	}
+
+	boycotted := map[uint]bool{}
+	if len(brandIDs) > 0 {
+		var ids []uint
+		if err := r.db.WithContext(ctx).Model(&entity.Brand{}).Scopes(boycottedBrandsAt(at)).Where("id IN ?", brandIDs).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			boycotted[id] = true
+		}
+	}
+
+	for _, match := range matches {
+		if match.CompanyID != nil {
+			// every listed company is boycotted
+			match.Company = companies[*match.CompanyID]
+			match.Boycotted = true
+		} else if match.BrandID != nil {
+			match.Brand = brands[*match.BrandID]
+			match.Boycotted = boycotted[*match.BrandID]
+		}
+	}
+
+	return nil
+}
+
+const (
+	facetType     = "type"
+	facetCategory = "category"
+	facetCountry  = "country"
+	facetStatus   = "status"
+)
+
+// facetRow is the number of feed rows with a value of a facet, or the total number of rows when Facet is empty
+type facetRow struct {
+	Facet string
+	Value string
+	Count int64
+}
+
+// CountFacets counts the total and every facet in one pass over the feed. Each grouping set counts
+// its rows with the filters of the other facets only, GROUPING tells which set a row comes from.
+func (r *repository) CountFacets(ctx context.Context, args *getBoycottedArgs) ([]*facetRow, error) {
+	var rows []*facetRow
+	query := fmt.Sprintf(`WITH feed AS (%[1]s)
+		SELECT CASE GROUPING(type, category, country, status) WHEN 7 THEN '%[2]s' WHEN 11 THEN '%[3]s' WHEN 13 THEN '%[4]s' WHEN 14 THEN '%[5]s' ELSE '' END AS facet,
+			COALESCE(type, category, country, status, '') AS value,
+			CASE GROUPING(type, category, country, status)
+				WHEN 7 THEN COUNT(*) FILTER (WHERE %[6]s)
+				WHEN 11 THEN COUNT(*) FILTER (WHERE %[7]s)
+				WHEN 13 THEN COUNT(*) FILTER (WHERE %[8]s)
+				WHEN 14 THEN COUNT(*) FILTER (WHERE %[9]s)
+				ELSE COUNT(*) FILTER (WHERE %[10]s) END AS count
+		FROM feed
+		GROUP BY GROUPING SETS ((), (type), (category), (country), (status))`,
+		boycottedFeedQuery(args.Keyword), facetType, facetCategory, facetCountry, facetStatus,
+		facetCondition(args, facetType), facetCondition(args, facetCategory), facetCondition(args, facetCountry),
+		facetCondition(args, facetStatus), facetCondition(args, ""))
+
+	if err := r.db.WithContext(ctx).Raw(query, boycottedFeedArgs(args)...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// facetCondition applies the facet filters of the arguments to feed rows, except the given facet's own filter
+func facetCondition(args *getBoycottedArgs, except string) string {
+	conditions := []string{"TRUE"}
+	for _, filter := range []struct {
+		facet  string
+		values []string
+	}{
+		{facetType, args.Types},
+		{facetCategory, args.Categories},
+		{facetCountry, args.Countries},
+		{facetStatus, args.Statuses},
+	} {
+		if filter.facet != except && len(filter.values) > 0 {
+			conditions = append(conditions, fmt.Sprintf("%[1]s IN @%[1]s_filter", filter.facet))
+		}
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+func (r *repository) Count(ctx context.Context, args *getBrandsArgs) (int64, error) {
 	var count int64
-	key := "%" + keyword + "%"
-	if err := r.db.WithContext(ctx).Model(&entity.Brand{}).Where("LOWER(name) LIKE LOWER(?)", key).Count(&count).Error; err != nil {
+	query := r.db.WithContext(ctx).Model(&entity.Brand{}).Scopes(filterBrands(args))
+
+	if err := query.Count(&count).Error; err != nil {
 		return 0, err
 	}
+
 	return count, nil
 }
 
-func (r *repository) Update(ctx context.Context, brandID uint, data map[string]interface{}) error {
-	result := r.db.WithContext(ctx).Model(&entity.Brand{}).Where("id = ?", brandID).Updates(data)
+func (r *repository) Find(ctx context.Context, args *getBrandsArgs, paginationParams *pagination.PaginationParams) ([]*entity.Brand, error) {
+	var brands []*entity.Brand
+	query := r.db.WithContext(ctx).Model(&entity.Brand{}).Scopes(filterBrands(args)).
+		Preload("Company").
+		Preload("Owners", orderOwnerships).
+		Preload("Owners.Company")
+
+	if err := query.Limit(paginationParams.Limit).Offset(paginationParams.Offset).Order(args.Sort.Order(false)).Find(&brands).Error; err != nil {
+		return nil, err
+	}
+
+	return brands, nil
+}
+
+func (r *repository) FindByCursor(ctx context.Context, args *getBrandsArgs, cursorParams *pagination.CursorParams) ([]*entity.Brand, error) {
+	var brands []*entity.Brand
+	query := r.db.WithContext(ctx).Model(&entity.Brand{}).Scopes(filterBrands(args)).
+		Preload("Company").
+		Preload("Owners", orderOwnerships).
+		Preload("Owners.Company")
+
+	if err := query.Scopes(cursorParams.Scope(args.Sort)).Find(&brands).Error; err != nil {
+		return nil, err
+	}
+
+	return brands, nil
+}
+
+func (r *repository) UpdateInTx(ctx context.Context, tx *gorm.DB, brandID uint, data map[string]interface{}) error {
+	result := tx.WithContext(ctx).Model(&entity.Brand{}).Where("id = ?", brandID).Updates(data)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrForeignKeyViolated) {
 			return errors.New(common.CompanyNotFound)
@@ -115,6 +390,102 @@ func (r *repository) Update(ctx context.Context, brandID uint, data map[string]i
 	return nil
 }
 
+func (r *repository) TransferPrimaryOwnerInTx(ctx context.Context, tx *gorm.DB, args *transferPrimaryOwnerArgs) error {
+	// the ongoing periods of the new company, as a co-owner or a licensor, end with those of the
+	// previous one so that it is left with a single open period as the owner
+	companyIDs := []uint{args.OldCompanyID, args.NewCompanyID}
+
+	// a period closed before it started would break the lookups by date
+	var backdated int64
+	if err := tx.WithContext(ctx).Model(&entity.BrandOwnership{}).
+		Where("brand_id = ? AND company_id IN ? AND ended_at IS NULL AND started_at > ?", args.BrandID, companyIDs, args.TransferredAt).
+		Count(&backdated).Error; err != nil {
+		return err
+	}
+
+	if backdated > 0 {
+		return errors.New(common.InvalidDate)
+	}
+
+	if err := tx.WithContext(ctx).Model(&entity.BrandOwnership{}).
+		Where("brand_id = ? AND company_id IN ? AND ended_at IS NULL", args.BrandID, companyIDs).
+		Update(common.ColumnEndedAt, args.TransferredAt).Error; err != nil {
+		return err
+	}
+
+	return tx.WithContext(ctx).Create(&entity.BrandOwnership{
+		BrandID:   args.BrandID,
+		CompanyID: args.NewCompanyID,
+		Role:      entity.OwnershipRoleOwner,
+		StartedAt: &args.TransferredAt,
+		SourceURL: args.SourceURL,
+	}).Error
+}
+
+func (r *repository) FindOwnerships(ctx context.Context, brandID uint) ([]*entity.BrandOwnership, error) {
+	var ownerships []*entity.BrandOwnership
+	if err := r.db.WithContext(ctx).Model(&entity.BrandOwnership{}).Scopes(orderOwnerships).Preload("Company").Where("brand_id = ?", brandID).Find(&ownerships).Error; err != nil {
+		return nil, err
+	}
+
+	return ownerships, nil
+}
+
+func (r *repository) FindOneOwnership(ctx context.Context, brandID, ownershipID uint) (*entity.BrandOwnership, error) {
+	var ownership *entity.BrandOwnership
+	if err := r.db.WithContext(ctx).Model(&entity.BrandOwnership{}).First(&ownership, "id = ? AND brand_id = ?", ownershipID, brandID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New(common.OwnershipNotFound)
+		}
+
+		return nil, err
+	}
+
+	return ownership, nil
+}
+
+func (r *repository) CreateOwnership(ctx context.Context, ownership *entity.BrandOwnership) error {
+	if err := r.db.WithContext(ctx).Create(ownership).Error; err != nil {
+		if errors.Is(err, gorm.ErrForeignKeyViolated) {
+			return errors.New(common.CompanyNotFound)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateOwnership(ctx context.Context, ownershipID uint, data map[string]interface{}) error {
+	result := r.db.WithContext(ctx).Model(&entity.BrandOwnership{}).Where("id = ?", ownershipID).Updates(data)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrForeignKeyViolated) {
+			return errors.New(common.CompanyNotFound)
+		}
+
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New(common.OwnershipNotFound)
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteOwnership(ctx context.Context, ownershipID uint) error {
+	result := r.db.WithContext(ctx).Delete(&entity.BrandOwnership{}, "id = ?", ownershipID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New(common.OwnershipNotFound)
+	}
+
+	return nil
+}
+
 func (r *repository) Delete(ctx context.Context, brandID uint) error {
 	result := r.db.WithContext(ctx).Delete(&entity.Brand{}, "id = ?", brandID)
 	if result.Error != nil {
@@ -128,11 +499,182 @@ func (r *repository) Delete(ctx context.Context, brandID uint) error {
 	return nil
 }
 
-// calculateQueryLimitBrand calculates the limit for loading brands based on the number of companies found
-func calculateQueryLimitBrand(rowsAffected int64, limit int) int64 {
-	if rowsAffected < int64(limit) {
-		return int64(limit) + (int64(limit) - rowsAffected)
+func filterBrands(args *getBrandsArgs) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if args.CompanyID != 0 {
+			db = db.Where("brands.company_id = ? OR EXISTS (SELECT 1 FROM brand_ownerships bo WHERE bo.brand_id = brands.id AND bo.company_id = ? AND bo.ended_at IS NULL)", args.CompanyID, args.CompanyID)
+		}
+
+		if args.Category != "" {
+			db = db.Where("LOWER(category) = LOWER(?)", args.Category)
+		}
+
+		if args.CreatedFrom != nil {
+			db = db.Where("created_at >= ?", *args.CreatedFrom)
+		}
+
+		if args.CreatedTo != nil {
+			db = db.Where("created_at < ?", *args.CreatedTo)
+		}
+
+		return db
+	}
+}
+
+// boycottedFeedQuery lists matching companies and brands as one result set, along with the
+// facets they can be filtered by. Brands that were boycotted before the date but no longer are
+// listed as cleared. It expects the named arguments from boycottedFeedArgs. Without a keyword
+// every listed company and brand matches with a zero score.
+func boycottedFeedQuery(keyword string) string {
+	companyTiers, brandTiers := matchTiers("companies", "company_id"), matchTiers("brands", "brand_id")
+	return fmt.Sprintf(`SELECT '%[1]s' AS type, id, name, '%[3]s' AS status, ''::text AS category, COALESCE(country, '') AS country,
+			%[5]s, %[6]s, %[7]s
+		FROM companies WHERE %[8]s
+		UNION ALL
+		SELECT '%[2]s' AS type, id, name,
+			CASE WHEN EXISTS (SELECT 1 FROM brand_ownerships bo WHERE bo.brand_id = brands.id AND bo.role IN @roles
+				AND (bo.started_at IS NULL OR bo.started_at <= @at) AND (bo.ended_at IS NULL OR bo.ended_at > @at))
+				THEN '%[3]s' ELSE '%[4]s' END AS status,
+			COALESCE(category, '') AS category,
+			COALESCE((SELECT c.country FROM companies c WHERE c.id = brands.company_id), '') AS country,
+			%[9]s, %[10]s, %[7]s
+		FROM brands WHERE %[11]s
+			AND EXISTS (SELECT 1 FROM brand_ownerships bo WHERE bo.brand_id = brands.id AND bo.role IN @roles
+				AND (bo.started_at IS NULL OR bo.started_at <= @at))`,
+		sourceCompany, sourceBrand, statusBoycotted, statusCleared,
+		matchTypeColumn(keyword, companyTiers), scoreColumn(keyword, companyTiers), headlineColumn(keyword), keywordCondition(keyword, companyTiers),
+		matchTypeColumn(keyword, brandTiers), scoreColumn(keyword, brandTiers), keywordCondition(keyword, brandTiers))
+}
+
+// boycottedFeedArgs binds the keyword twice: as typed for the full-text search, which normalizes
+// it on its own, and as a search key for matching the normalized names and aliases
+func boycottedFeedArgs(args *getBoycottedArgs, extra ...interface{}) []interface{} {
+	key := search.TermKey(args.Keyword)
+	prefix, pattern := "", ""
+	if key != "" {
+		prefix, pattern = helper.EscapeLike(key)+"%", "%"+helper.EscapeLike(key)+"%"
+	}
+
+	return append([]interface{}{
+		sql.Named("query", args.Keyword),
+		sql.Named("key", key),
+		sql.Named("key_prefix", prefix),
+		sql.Named("key_pattern", pattern),
+		sql.Named("at", args.At),
+		sql.Named("roles", entity.BoycottOwnershipRoles),
+		sql.Named(facetType+"_filter", args.Types),
+		sql.Named(facetCategory+"_filter", args.Categories),
+		sql.Named(facetCountry+"_filter", args.Countries),
+		sql.Named(facetStatus+"_filter", args.Statuses),
+	}, extra...)
+}
+
+const (
+	matchTypeExact       = "exact"
+	matchTypeAlias       = "alias"
+	matchTypePrefix      = "prefix"
+	matchTypeFuzzy       = "fuzzy"
+	matchTypeDescription = "description"
+)
+
+type matchTier struct {
+	matchType string
+	condition string
+	score     string
+}
+
+// matchTiers lists the ways a row of the table can match a keyword from the best to the worst. A row
+// takes the first tier it meets, and the score ranges of the tiers do not overlap so a better match
+// always ranks higher. Within a tier, rows closer to the keyword score higher. Names and aliases are
+// compared by their normalized search terms, the column links the terms to the table.
+func matchTiers(table, column string) []matchTier {
+	terms := func(condition string) string {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM search_terms st WHERE st.%s = %s.id AND %s)", column, table, condition)
+	}
+
+	similarity := func(condition string) string {
+		return fmt.Sprintf("COALESCE((SELECT MAX(similarity(st.key, @key)) FROM search_terms st WHERE st.%s = %s.id AND %s), 0)", column, table, condition)
+	}
+
+	return []matchTier{
+		{matchTypeExact, terms("NOT st.alias AND st.key = @key"), "1"},
+		{matchTypeAlias, terms("st.alias AND st.key = @key"), "0.9"},
+		{matchTypePrefix, terms("NOT st.alias AND st.key LIKE @key_prefix"), "0.7 + 0.1 * " + similarity("NOT st.alias")},
+		{matchTypeFuzzy, terms("(st.key LIKE @key_pattern OR st.key % @key)"), "0.4 + 0.2 * " + similarity("TRUE")},
+		{matchTypeDescription, "search_vector @@ websearch_to_tsquery('buycut_indonesian', @query)",
+			"0.1 + 0.2 * ts_rank_cd(search_vector, websearch_to_tsquery('buycut_indonesian', @query), 32)"},
+	}
+}
+
+// matchTypeColumn names the best tier a row matches
+func matchTypeColumn(keyword string, tiers []matchTier) string {
+	if keyword == "" {
+		return "''::text AS match_type"
+	}
+
+	var cases strings.Builder
+	for _, tier := range tiers {
+		fmt.Fprintf(&cases, " WHEN %s THEN '%s'", tier.condition, tier.matchType)
+	}
+
+	return "CASE" + cases.String() + " ELSE '' END AS match_type"
+}
+
+// scoreColumn scores a row within the best tier it matches, from 0 to 1
+func scoreColumn(keyword string, tiers []matchTier) string {
+	if keyword == "" {
+		return "0::float8 AS search_score"
+	}
+
+	var cases strings.Builder
+	for _, tier := range tiers {
+		fmt.Fprintf(&cases, " WHEN %s THEN %s", tier.condition, tier.score)
 	}
 
-	return int64(limit)
+	return "(CASE" + cases.String() + " ELSE 0 END)::float8 AS search_score"
+}
+
+// headlineColumn highlights the description of rows that match the full-text search
+func headlineColumn(keyword string) string {
+	if keyword == "" {
+		return "''::text AS search_headline"
+	}
+
+	return `CASE WHEN search_vector @@ websearch_to_tsquery('buycut_indonesian', @query)
+		THEN ts_headline('buycut_indonesian', COALESCE(description, ''), websearch_to_tsquery('buycut_indonesian', @query), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')
+		ELSE '' END AS search_headline`
+}
+
+// keywordCondition keeps rows that meet any of the match tiers
+func keywordCondition(keyword string, tiers []matchTier) string {
+	if keyword == "" {
+		return "TRUE"
+	}
+
+	conditions := make([]string, len(tiers))
+	for i, tier := range tiers {
+		conditions[i] = tier.condition
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// boycottedBrandsAt keeps only brands related to a listed company through a role that counts on the given date
+func boycottedBrandsAt(at time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`EXISTS (SELECT 1 FROM brand_ownerships bo WHERE bo.brand_id = brands.id AND bo.role IN ?
+			AND (bo.started_at IS NULL OR bo.started_at <= ?) AND (bo.ended_at IS NULL OR bo.ended_at > ?))`,
+			entity.BoycottOwnershipRoles, at, at)
+	}
+}
+
+// activeOwnershipsAt keeps only ownership periods that cover the given date
+func activeOwnershipsAt(at time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(started_at IS NULL OR started_at <= ?) AND (ended_at IS NULL OR ended_at > ?)", at, at).Scopes(orderOwnerships)
+	}
+}
+
+func orderOwnerships(db *gorm.DB) *gorm.DB {
+	return db.Order("started_at ASC NULLS FIRST, id ASC")
 }
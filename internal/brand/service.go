@@ -3,56 +3,105 @@ package brand
 import (
 	"context"
 	"errors"
-	"sort"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ariefro/buycut-api/config"
 	"github.com/ariefro/buycut-api/internal/cloudstorage"
 	"github.com/ariefro/buycut-api/internal/company"
 	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/internal/search"
 	"github.com/ariefro/buycut-api/pkg/common"
 	"github.com/ariefro/buycut-api/pkg/helper"
 	"github.com/ariefro/buycut-api/pkg/pagination"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type Service interface {
 	Create(ctx context.Context, args *createBrandArgs) error
 	FindByKeyword(ctx context.Context, args *getBrandByKeywordRequest) (interface{}, error)
+	Suggest(ctx context.Context, keyword string) (string, error)
 	FindOneByID(ctx context.Context, brandID uint) (*entity.Brand, error)
-	FindAll(ctx context.Context, args *getBrandByKeywordRequest, paginationParams *pagination.PaginationParams) ([]*boycottedResult, error)
-	CountAll(ctx context.Context, args *getBrandByKeywordRequest) (int64, error)
+	ParseBoycottedArgs(request *getBrandByKeywordRequest) (*getBoycottedArgs, error)
+	FindAll(ctx context.Context, args *getBoycottedArgs, paginationParams *pagination.PaginationParams) ([]*boycottedResult, error)
+	CountFacets(ctx context.Context, args *getBoycottedArgs) (int64, *boycottedFacets, error)
+	RecordSearch(keyword string, results int64)
+	LookupBatch(ctx context.Context, args *lookupBatchRequest) ([]*lookupResult, error)
+	Scan(ctx context.Context, args *scanRequest) ([]*scanMention, error)
+	ParseFindArgs(request *getBrandsRequest) (*getBrandsArgs, error)
+	Count(ctx context.Context, args *getBrandsArgs) (int64, error)
+	Find(ctx context.Context, args *getBrandsArgs, paginationParams *pagination.PaginationParams) ([]*boycottedResult, error)
+	FindByCursor(ctx context.Context, args *getBrandsArgs, cursorParams *pagination.CursorParams) ([]*boycottedResult, *pagination.CursorPages, error)
 	Update(ctx context.Context, brandID uint, args *updateBrandArgs) error
 	Delete(ctx context.Context, brand *entity.Brand) error
+	FindOwnerships(ctx context.Context, brandID uint) ([]*entity.BrandOwnership, error)
+	CreateOwnership(ctx context.Context, brand *entity.Brand, args *brandOwnershipRequest) error
+	UpdateOwnership(ctx context.Context, brand *entity.Brand, ownershipID uint, args *brandOwnershipRequest) error
+	DeleteOwnership(ctx context.Context, brand *entity.Brand, ownershipID uint) error
+	PresignImageUpload(ctx context.Context, brand *entity.Brand) (*cloudstorage.PresignedUpload, error)
+	FinalizeImageUpload(ctx context.Context, brand *entity.Brand) (entity.Images, error)
 }
 
 type service struct {
-	config      *config.Config
-	repo        Repository
-	companyRepo company.Repository
+	db            *gorm.DB
+	config        *config.Config
+	repo          Repository
+	companyRepo   company.Repository
+	searchRepo    search.Repository
+	searchService search.Service
+	storage       cloudstorage.Storage
 }
 
-func NewService(config *config.Config, repo Repository, companyRepo company.Repository) Service {
-	return &service{config, repo, companyRepo}
+func NewService(db *gorm.DB, config *config.Config, repo Repository, companyRepo company.Repository, searchRepo search.Repository, searchService search.Service, storage cloudstorage.Storage) Service {
+	return &service{db, config, repo, companyRepo, searchRepo, searchService, storage}
 }
 
 func (s *service) Create(ctx context.Context, args *createBrandArgs) error {
+	role := args.Request.Role
+	if role == "" {
+		role = entity.OwnershipRoleOwner
+	}
+
+	if !entity.IsValidOwnershipRole(role) {
+		return errors.New(common.InvalidOwnershipRole)
+	}
+
 	slug := helper.GenerateSlug(args.Request.Name)
-	imageURL, err := cloudstorage.UploadImage(ctx, &cloudstorage.UploadImageArgs{
+	images, err := cloudstorage.UploadImage(ctx, s.storage, &cloudstorage.UploadImageArgs{
 		CompanyID: args.CompanyID,
 		File:      args.FormHeader,
+		SourceURL: args.Request.ImageSourceURL,
 		Slug:      slug,
-	}, s.configureCloudinary())
+		Limits:    s.config.BrandImageLimits(),
+	})
 	if err != nil {
 		return err
 	}
 
 	brand := &entity.Brand{
-		Name:      args.Request.Name,
-		Slug:      slug,
-		CompanyID: args.Request.CompanyID,
-		ImageURL:  imageURL,
+		Name:        args.Request.Name,
+		Slug:        slug,
+		CompanyID:   args.Request.CompanyID,
+		Images:      images,
+		Description: args.Request.Description,
+		Proof:       args.Request.Proof,
+		Category:    args.Request.Category,
+		Aliases:     args.Request.Aliases,
+		Domains:     helper.NormalizeDomains(args.Request.Domains),
+		Owners: []entity.BrandOwnership{
+			{CompanyID: args.Request.CompanyID, Role: role},
+		},
 	}
 
-	return s.repo.Create(ctx, brand)
+	if err := s.repo.Create(ctx, brand); err != nil {
+		return err
+	}
+
+	return s.searchRepo.ReplaceBrandTerms(ctx, brand.ID, brand.Name, brand.Aliases)
 }
 
 func (s *service) FindOneByID(ctx context.Context, brandID uint) (*entity.Brand, error) {
@@ -60,11 +109,23 @@ func (s *service) FindOneByID(ctx context.Context, brandID uint) (*entity.Brand,
 }
 
 func (s *service) FindByKeyword(ctx context.Context, args *getBrandByKeywordRequest) (interface{}, error) {
-	companies, brands, err := s.repo.FindByKeyword(ctx, args.Keyword)
+	at, err := resolveDate(args.Date)
 	if err != nil {
 		return nil, err
 	}
 
+	companies, brands, err := s.repo.FindByKeyword(ctx, args.Keyword, at)
+	if err != nil {
+		return nil, err
+	}
+
+	results := len(companies)
+	if results == 0 {
+		results = len(brands)
+	}
+
+	s.searchService.Record(args.Keyword, int64(results))
+
 	if len(companies) > 0 {
 		return companies, nil
 	} else if len(brands) > 0 {
@@ -74,97 +135,490 @@ func (s *service) FindByKeyword(ctx context.Context, args *getBrandByKeywordRequ
 	}
 }
 
-func (s *service) FindAll(ctx context.Context, args *getBrandByKeywordRequest, paginationParams *pagination.PaginationParams) ([]*boycottedResult, error) {
-	companies, brands, err := s.repo.FindAll(ctx, args, paginationParams)
+// Suggest returns the listed name closest to the keyword, or an empty string when nothing is close enough
+func (s *service) Suggest(ctx context.Context, keyword string) (string, error) {
+	return s.repo.FindClosestName(ctx, keyword)
+}
+
+const (
+	statusBoycotted = "boycotted"
+	statusCleared   = "cleared"
+)
+
+func (s *service) ParseBoycottedArgs(request *getBrandByKeywordRequest) (*getBoycottedArgs, error) {
+	at, err := resolveDate(request.Date)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []*boycottedResult
-	for _, company := range companies {
-		results = append(results, &boycottedResult{
-			ID:          company.ID,
-			Name:        company.Name,
-			Slug:        company.Slug,
-			Description: company.Description,
-			ImageURL:    company.ImageURL,
-			Proof:       company.Proof,
-			Company:     nil,
-			Type:        "company",
-		})
+	args := &getBoycottedArgs{
+		Keyword:    request.Keyword,
+		At:         at,
+		Types:      splitFilter(strings.ToLower(request.Type)),
+		Categories: splitFilter(request.Category),
+		Countries:  splitFilter(strings.ToUpper(request.Country)),
+		Statuses:   splitFilter(strings.ToLower(request.Status)),
 	}
 
-	for _, brand := range brands {
-		results = append(results, &boycottedResult{
-			ID:          brand.ID,
-			Name:        brand.Name,
-			Slug:        brand.Slug,
-			Description: brand.Company.Description,
-			ImageURL:    brand.ImageURL,
-			Proof:       brand.Company.Proof,
-			Company:     brand.Company,
-			Type:        "brand",
-		})
+	if len(args.Statuses) == 0 {
+		args.Statuses = []string{statusBoycotted}
 	}
 
-	// Sort results by name in ascending order
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Name < results[j].Name
-	})
+	for _, value := range args.Types {
+		if value != sourceCompany && value != sourceBrand {
+			return nil, errors.New(common.InvalidSearchFilter)
+		}
+	}
+
+	for _, value := range args.Statuses {
+		if value != statusBoycotted && value != statusCleared {
+			return nil, errors.New(common.InvalidSearchFilter)
+		}
+	}
+
+	return args, nil
+}
+
+func (s *service) FindAll(ctx context.Context, args *getBoycottedArgs, paginationParams *pagination.PaginationParams) ([]*boycottedResult, error) {
+	matches, err := s.repo.FindAll(ctx, args, paginationParams)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*boycottedResult, 0, len(matches))
+	for _, match := range matches {
+		var result *boycottedResult
+		switch {
+		case match.Company != nil:
+			result = newCompanyResult(match.Company)
+		case match.Brand != nil:
+			result = newBrandResult(match.Brand)
+		default:
+			// the row was deleted between the feed query and loading it
+			continue
+		}
+
+		result.Status = match.Status
+		result.Highlight = match.SearchHeadline
+		result.MatchType = match.MatchType
+		result.Score = match.SearchScore
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// RecordSearch adds a search to the search analytics
+func (s *service) RecordSearch(keyword string, results int64) {
+	s.searchService.Record(keyword, results)
+}
+
+// CountFacets returns the number of results along with the facet counts, both from a single query
+func (s *service) CountFacets(ctx context.Context, args *getBoycottedArgs) (int64, *boycottedFacets, error) {
+	rows, err := s.repo.CountFacets(ctx, args)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var total int64
+	facets := &boycottedFacets{
+		Type:     []*facetCount{},
+		Category: []*facetCount{},
+		Country:  []*facetCount{},
+		Status:   []*facetCount{},
+	}
+
+	for _, row := range rows {
+		switch {
+		case row.Facet == "":
+			total = row.Count
+		case row.Count == 0 || row.Value == "":
+			// values that only appear outside the other filters, and unknown categories or countries
+		case row.Facet == facetType:
+			facets.Type = append(facets.Type, &facetCount{row.Value, row.Count})
+		case row.Facet == facetCategory:
+			facets.Category = append(facets.Category, &facetCount{row.Value, row.Count})
+		case row.Facet == facetCountry:
+			facets.Country = append(facets.Country, &facetCount{row.Value, row.Count})
+		case row.Facet == facetStatus:
+			facets.Status = append(facets.Status, &facetCount{row.Value, row.Count})
+		}
+	}
+
+	return total, facets, nil
+}
+
+// MaxLookupItems is the most items a single lookup batch may contain
+const MaxLookupItems = 300
+
+const (
+	lookupKindName    = "name"
+	lookupKindDomain  = "domain"
+	lookupKindBarcode = "barcode"
+
+	verdictBoycotted    = "boycotted"
+	verdictNotBoycotted = "not_boycotted"
+	verdictNotFound     = "not_found"
+	verdictAmbiguous    = "ambiguous"
+)
+
+// LookupBatch gives a verdict for every item of a shopping list, resolving the whole list with a fixed number of queries
+func (s *service) LookupBatch(ctx context.Context, args *lookupBatchRequest) ([]*lookupResult, error) {
+	if len(args.Items) == 0 || len(args.Items) > MaxLookupItems {
+		return nil, errors.New(common.InvalidLookupItems)
+	}
+
+	at, err := resolveDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	itemKeys := make([][]*lookupKey, len(args.Items))
+	keys := &lookupKeys{}
+	seen := map[lookupKey]struct{}{}
+	for i, item := range args.Items {
+		itemKeys[i] = parseLookupItem(item)
+		for _, key := range itemKeys[i] {
+			if _, ok := seen[*key]; ok {
+				continue
+			}
+
+			seen[*key] = struct{}{}
+			switch key.Kind {
+			case lookupKindDomain:
+				keys.Domains = append(keys.Domains, key.Key)
+			case lookupKindBarcode:
+				keys.Barcodes = append(keys.Barcodes, key.Key)
+			default:
+				keys.Names = append(keys.Names, key.Key)
+			}
+		}
+	}
+
+	matches, err := s.repo.FindLookupMatches(ctx, keys, at)
+	if err != nil {
+		return nil, err
+	}
+
+	matchesByKey := map[string][]*lookupMatch{}
+	for _, match := range matches {
+		if match.Company == nil && match.Brand == nil {
+			// the row was deleted between the match query and loading it
+			continue
+		}
+
+		matchesByKey[match.Kind+":"+match.Key] = append(matchesByKey[match.Kind+":"+match.Key], match)
+	}
+
+	results := make([]*lookupResult, 0, len(args.Items))
+	for i, item := range args.Items {
+		result := &lookupResult{Input: item, Kind: lookupKindName, Verdict: verdictNotFound}
+		if len(itemKeys[i]) > 0 {
+			result.Kind = itemKeys[i][0].Kind
+		}
+
+		// keys are ordered from the most to the least specific, the first one that matches wins
+		var candidates []*lookupMatch
+		for _, key := range itemKeys[i] {
+			if candidates = uniqueLookupMatches(matchesByKey[key.Kind+":"+key.Key]); len(candidates) > 0 {
+				result.Kind = key.Kind
+				break
+			}
+		}
+
+		switch len(candidates) {
+		case 0:
+		case 1:
+			result.Match = newLookupMatchResult(candidates[0])
+			result.Verdict = verdictNotBoycotted
+			if candidates[0].Boycotted {
+				result.Verdict = verdictBoycotted
+			}
+		default:
+			result.Verdict = verdictAmbiguous
+			for _, candidate := range candidates {
+				result.Candidates = append(result.Candidates, newLookupMatchResult(candidate))
+			}
+		}
+
+		results = append(results, result)
+	}
 
 	return results, nil
 }
 
-func (s *service) CountAll(ctx context.Context, args *getBrandByKeywordRequest) (int64, error) {
-	companyCount, err := s.companyRepo.CountCompanies(ctx, args.Keyword)
+// MaxScanTextLength is the most characters a scanned text may contain
+const MaxScanTextLength = 10000
+
+// Scan returns the boycotted companies and brands mentioned in the text, in the order they appear
+func (s *service) Scan(ctx context.Context, args *scanRequest) ([]*scanMention, error) {
+	if utf8.RuneCountInString(args.Text) > MaxScanTextLength {
+		return nil, errors.New(common.ScanTextTooLong)
+	}
+
+	at, err := resolveDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions, err := s.searchService.Scan(ctx, args.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*lookupMatch, len(mentions))
+	for i, mention := range mentions {
+		matches[i] = &lookupMatch{CompanyID: mention.CompanyID, BrandID: mention.BrandID}
+	}
+
+	if err := s.repo.ResolveLookupMatches(ctx, matches, at); err != nil {
+		return nil, err
+	}
+
+	type mentionKey struct {
+		start  int
+		source string
+		id     uint
+	}
+
+	results := []*scanMention{}
+	seen := map[mentionKey]struct{}{}
+	for i, match := range matches {
+		if !match.Boycotted || (match.Company == nil && match.Brand == nil) {
+			continue
+		}
+
+		result := newLookupMatchResult(match)
+		key := mentionKey{mentions[i].Start, result.Type, result.ID}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		results = append(results, &scanMention{
+			Text:  mentions[i].Text,
+			Start: mentions[i].Start,
+			End:   mentions[i].End,
+			Match: result,
+		})
+	}
+
+	return results, nil
+}
+
+// brandSorts maps the accepted sort values to the column the list is ordered by
+var brandSorts = map[string]pagination.Sort{
+	"":            {Column: common.ColumnName},
+	"name":        {Column: common.ColumnName},
+	"-name":       {Column: common.ColumnName, Desc: true},
+	"created_at":  {Column: common.ColumnCreatedAt, Timestamp: true},
+	"-created_at": {Column: common.ColumnCreatedAt, Desc: true, Timestamp: true},
+}
+
+func (s *service) ParseFindArgs(request *getBrandsRequest) (*getBrandsArgs, error) {
+	sort, ok := brandSorts[request.Sort]
+	if !ok {
+		return nil, errors.New(common.InvalidSortField)
+	}
+
+	createdFrom, err := parseOptionalDate(request.CreatedFrom)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	createdTo, err := parseOptionalDate(request.CreatedTo)
+	if err != nil {
+		return nil, err
 	}
 
-	brandCount, err := s.repo.CountBrands(ctx, args.Keyword)
+	// include the whole day of the upper bound
+	if createdTo != nil {
+		nextDay := createdTo.AddDate(0, 0, 1)
+		createdTo = &nextDay
+	}
+
+	return &getBrandsArgs{
+		CompanyID:   request.CompanyID,
+		Category:    request.Category,
+		CreatedFrom: createdFrom,
+		CreatedTo:   createdTo,
+		Sort:        sort,
+	}, nil
+}
+
+func (s *service) Count(ctx context.Context, args *getBrandsArgs) (int64, error) {
+	return s.repo.Count(ctx, args)
+}
+
+func (s *service) Find(ctx context.Context, args *getBrandsArgs, paginationParams *pagination.PaginationParams) ([]*boycottedResult, error) {
+	brands, err := s.repo.Find(ctx, args, paginationParams)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	results := companyCount + brandCount
+	results := make([]*boycottedResult, 0, len(brands))
+	for _, brand := range brands {
+		results = append(results, newBrandResult(brand))
+	}
 
 	return results, nil
 }
 
+func (s *service) FindByCursor(ctx context.Context, args *getBrandsArgs, cursorParams *pagination.CursorParams) ([]*boycottedResult, *pagination.CursorPages, error) {
+	brands, err := s.repo.FindByCursor(ctx, args, cursorParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	brands, pages := pagination.NewCursorPages(cursorParams, args.Sort, brands, func(brand *entity.Brand) (string, uint) {
+		if args.Sort.Timestamp {
+			return brand.CreatedAt.Format(time.RFC3339Nano), brand.ID
+		}
+
+		return brand.Name, brand.ID
+	})
+
+	results := make([]*boycottedResult, 0, len(brands))
+	for _, brand := range brands {
+		results = append(results, newBrandResult(brand))
+	}
+
+	return results, pages, nil
+}
+
 func (s *service) Update(ctx context.Context, brandID uint, args *updateBrandArgs) error {
+	transferredAt, err := resolveDate(args.Request.TransferredAt)
+	if err != nil {
+		return err
+	}
+
 	dataToUpdate := map[string]interface{}{}
 
 	slug := helper.GenerateSlug(args.Request.Name)
 	dataToUpdate[common.ColumnName] = args.Request.Name
 	dataToUpdate[common.ColumnSlug] = slug
 
-	if args.Request.CompanyID != nil {
-		dataToUpdate[common.ColumnCompanyID] = args.Request.CompanyID
+	if args.Request.Category != nil {
+		dataToUpdate[common.ColumnCategory] = *args.Request.Category
 	}
 
-	if args.FormHeader != nil {
-		// jika nama dari produk tidak sama dengan nama dari request, maka hapus file yang lama
-		if args.Brand.Name != args.Request.Name {
-			cloudstorage.DeleteFile(&cloudstorage.DeleteArgs{
-				CompanyID: args.Brand.Company.ID,
-				Config:    s.configureCloudinary(),
-				Slug:      args.Brand.Slug,
-			})
+	if args.Request.Description != nil {
+		dataToUpdate[common.ColumnDescription] = *args.Request.Description
+	}
+
+	// a form cannot send an empty list, a single empty proof field clears the proofs instead
+	if args.Request.Proof != nil {
+		dataToUpdate[common.ColumnProof] = pq.StringArray(helper.CompactStrings(args.Request.Proof))
+	}
+
+	if args.Request.Aliases != nil {
+		dataToUpdate[common.ColumnAliases] = pq.StringArray(args.Request.Aliases)
+	}
+
+	if args.Request.Domains != nil {
+		dataToUpdate[common.ColumnDomains] = pq.StringArray(helper.NormalizeDomains(args.Request.Domains))
+	}
+
+	companyID := args.Brand.CompanyID
+	if args.Request.CompanyID != nil && *args.Request.CompanyID != args.Brand.CompanyID {
+		if _, err := s.companyRepo.FindOneByID(ctx, *args.Request.CompanyID); err != nil {
+			return err
 		}
 
-		imageURL, err := cloudstorage.UploadImage(ctx, &cloudstorage.UploadImageArgs{
-			CompanyID: args.Brand.Company.ID,
+		companyID = *args.Request.CompanyID
+		dataToUpdate[common.ColumnCompanyID] = companyID
+	}
+
+	// the image lives in the folder of the brand's company under the brand's slug
+	imageRelocated := companyID != args.Brand.CompanyID || slug != args.Brand.Slug
+
+	var uploadedImages entity.Images
+	var movedImage *cloudstorage.MoveArgs
+	var movedImages entity.Images
+	if args.FormHeader != nil || args.Request.ImageSourceURL != "" {
+		images, err := cloudstorage.UploadImage(ctx, s.storage, &cloudstorage.UploadImageArgs{
+			CompanyID: companyID,
 			File:      args.FormHeader,
+			SourceURL: args.Request.ImageSourceURL,
 			Slug:      slug,
-		}, s.configureCloudinary())
+			Limits:    s.config.BrandImageLimits(),
+		})
+		if err != nil {
+			return err
+		}
+
+		uploadedImages = images
+		dataToUpdate[common.ColumnImages] = uploadedImages
+		dataToUpdate[common.ColumnImageMissing] = false
+	} else if imageRelocated && len(args.Brand.Images) > 0 {
+		movedImage = &cloudstorage.MoveArgs{
+			FromCompanyID: args.Brand.CompanyID,
+			FromSlug:      args.Brand.Slug,
+			ToCompanyID:   companyID,
+			ToSlug:        slug,
+		}
+
+		images, err := cloudstorage.MoveImage(ctx, s.storage, movedImage, args.Brand.Images)
 		if err != nil {
 			return err
 		}
 
-		dataToUpdate[common.ColumnImageURL] = imageURL
+		movedImages = images
+		dataToUpdate[common.ColumnImages] = movedImages
+		dataToUpdate[common.ColumnImageMissing] = false
+	}
+
+	if errTx := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.repo.UpdateInTx(ctx, tx, brandID, dataToUpdate); err != nil {
+			return err
+		}
+
+		if companyID != args.Brand.CompanyID {
+			return s.repo.TransferPrimaryOwnerInTx(ctx, tx, &transferPrimaryOwnerArgs{
+				BrandID:       brandID,
+				OldCompanyID:  args.Brand.CompanyID,
+				NewCompanyID:  companyID,
+				TransferredAt: transferredAt,
+				SourceURL:     args.Request.SourceURL,
+			})
+		}
+
+		return nil
+	}); errTx != nil {
+		// restore the stored image so it matches the unchanged row, even when the request timed out
+		ctx := context.WithoutCancel(ctx)
+		if uploadedImages != nil {
+			if err := cloudstorage.DeleteImages(ctx, s.storage, uploadedImages); err != nil {
+				log.Errorln("failed to remove uploaded brand image:", err)
+			}
+		}
+
+		if movedImage != nil {
+			if _, err := cloudstorage.MoveImage(ctx, s.storage, movedImage.Reverse(), movedImages); err != nil {
+				log.Errorln("failed to move brand image back:", err)
+			}
+		}
+
+		return errTx
 	}
 
-	return s.repo.Update(ctx, brandID, dataToUpdate)
+	aliases := []string(args.Brand.Aliases)
+	if args.Request.Aliases != nil {
+		aliases = args.Request.Aliases
+	}
+
+	if err := s.searchRepo.ReplaceBrandTerms(ctx, brandID, args.Request.Name, aliases); err != nil {
+		return err
+	}
+
+	// the row already points at the new image, a leftover old one is removed by the reconciliation
+	if uploadedImages != nil {
+		if err := cloudstorage.DeleteImages(ctx, s.storage, args.Brand.Images); err != nil {
+			log.Errorln("failed to remove old brand image:", err)
+		}
+	}
+
+	return nil
 }
 
 func (s *service) Delete(ctx context.Context, brand *entity.Brand) error {
@@ -172,11 +626,7 @@ func (s *service) Delete(ctx context.Context, brand *entity.Brand) error {
 	if err != nil {
 		return err
 	} else {
-		if errDeleteFile := cloudstorage.DeleteFile(&cloudstorage.DeleteArgs{
-			CompanyID: brand.Company.ID,
-			Config:    s.configureCloudinary(),
-			Slug:      brand.Slug,
-		}); errDeleteFile != nil {
+		if errDeleteFile := cloudstorage.DeleteImages(ctx, s.storage, brand.Images); errDeleteFile != nil {
 			return errDeleteFile
 		}
 	}
@@ -184,13 +634,351 @@ func (s *service) Delete(ctx context.Context, brand *entity.Brand) error {
 	return nil
 }
 
-func (s *service) configureCloudinary() *config.CloudinaryConfig {
-	var config = &config.CloudinaryConfig{
-		CloudinaryCloudName:    s.config.CloudinaryCloudName,
-		CloudinaryApiKey:       s.config.CloudinaryApiKey,
-		CloudinarySecretKey:    s.config.CloudinarySecretKey,
-		CloudinaryBuycutFolder: s.config.CloudinaryBuycutFolder,
+func (s *service) PresignImageUpload(ctx context.Context, brand *entity.Brand) (*cloudstorage.PresignedUpload, error) {
+	return cloudstorage.PresignImageUpload(ctx, s.storage, s.directUploadArgs(brand))
+}
+
+// FinalizeImageUpload turns the image the client uploaded straight to the storage into the brand's image
+func (s *service) FinalizeImageUpload(ctx context.Context, brand *entity.Brand) (entity.Images, error) {
+	images, err := cloudstorage.FinalizeImageUpload(ctx, s.storage, s.directUploadArgs(brand))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateInTx(ctx, s.db, brand.ID, map[string]interface{}{
+		common.ColumnImages:       entity.Images(images),
+		common.ColumnImageMissing: false,
+	}); err != nil {
+		if errDelete := cloudstorage.DeleteImages(context.WithoutCancel(ctx), s.storage, images); errDelete != nil {
+			log.Errorln("failed to remove uploaded brand image:", errDelete)
+		}
+
+		return nil, err
+	}
+
+	// the row already points at the new image, a leftover old one is removed by the reconciliation
+	if err := cloudstorage.DeleteImages(ctx, s.storage, brand.Images); err != nil {
+		log.Errorln("failed to remove old brand image:", err)
+	}
+
+	return images, nil
+}
+
+// directUploadArgs binds a direct upload to the brand, its image lives in the folder of its company
+func (s *service) directUploadArgs(brand *entity.Brand) *cloudstorage.DirectUploadArgs {
+	return &cloudstorage.DirectUploadArgs{
+		CompanyID: brand.CompanyID,
+		Slug:      brand.Slug,
+		Limits:    s.config.BrandImageLimits(),
+	}
+}
+
+func (s *service) FindOwnerships(ctx context.Context, brandID uint) ([]*entity.BrandOwnership, error) {
+	return s.repo.FindOwnerships(ctx, brandID)
+}
+
+func (s *service) CreateOwnership(ctx context.Context, brand *entity.Brand, args *brandOwnershipRequest) error {
+	ownership, err := s.buildOwnership(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	ownership.BrandID = brand.ID
+	return s.repo.CreateOwnership(ctx, ownership)
+}
+
+func (s *service) UpdateOwnership(ctx context.Context, brand *entity.Brand, ownershipID uint, args *brandOwnershipRequest) error {
+	current, err := s.repo.FindOneOwnership(ctx, brand.ID, ownershipID)
+	if err != nil {
+		return err
+	}
+
+	ownership, err := s.buildOwnership(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	// the company of the brand is moved along with its primary ownership by a brand update
+	if current.CompanyID == brand.CompanyID && current.IsActiveAt(time.Now()) &&
+		(ownership.CompanyID != current.CompanyID || !sameDate(ownership.EndedAt, current.EndedAt)) {
+		return errors.New(common.PrimaryOwnerCannotBeChanged)
+	}
+
+	return s.repo.UpdateOwnership(ctx, ownershipID, map[string]interface{}{
+		common.ColumnCompanyID: ownership.CompanyID,
+		common.ColumnRole:      ownership.Role,
+		common.ColumnStake:     ownership.Stake,
+		common.ColumnStartedAt: ownership.StartedAt,
+		common.ColumnEndedAt:   ownership.EndedAt,
+		common.ColumnSourceURL: ownership.SourceURL,
+	})
+}
+
+func (s *service) DeleteOwnership(ctx context.Context, brand *entity.Brand, ownershipID uint) error {
+	ownership, err := s.repo.FindOneOwnership(ctx, brand.ID, ownershipID)
+	if err != nil {
+		return err
+	}
+
+	if ownership.CompanyID == brand.CompanyID && ownership.IsActiveAt(time.Now()) {
+		return errors.New(common.PrimaryOwnerCannotBeRemoved)
+	}
+
+	return s.repo.DeleteOwnership(ctx, ownershipID)
+}
+
+func (s *service) buildOwnership(ctx context.Context, args *brandOwnershipRequest) (*entity.BrandOwnership, error) {
+	if !entity.IsValidOwnershipRole(args.Role) {
+		return nil, errors.New(common.InvalidOwnershipRole)
+	}
+
+	if args.Stake != nil && (*args.Stake < 0 || *args.Stake > 100) {
+		return nil, errors.New(common.InvalidOwnershipStake)
+	}
+
+	startedAt, err := parseOptionalDate(args.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	endedAt, err := parseOptionalDate(args.EndedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if startedAt != nil && endedAt != nil && !endedAt.After(*startedAt) {
+		return nil, errors.New(common.InvalidOwnershipPeriod)
+	}
+
+	if _, err := s.companyRepo.FindOneByID(ctx, args.CompanyID); err != nil {
+		return nil, err
+	}
+
+	return &entity.BrandOwnership{
+		CompanyID: args.CompanyID,
+		Role:      args.Role,
+		Stake:     args.Stake,
+		StartedAt: startedAt,
+		EndedAt:   endedAt,
+		SourceURL: args.SourceURL,
+	}, nil
+}
+
+const (
+	sourceCompany = "company"
+	sourceBrand   = "brand"
+)
+
+func newCompanyResult(company *entity.Company) *boycottedResult {
+	result := &boycottedResult{
+		ID:          company.ID,
+		Name:        company.Name,
+		Slug:        company.Slug,
+		Description: company.Description,
+		Images:      company.Images,
+		Proof:       company.Proof,
+		Company:     nil,
+		Type:        sourceCompany,
+	}
+
+	result.Descriptions = appendSourced(nil, sourceCompany, company.Description)
+	result.Proofs = appendSourced(nil, sourceCompany, company.Proof...)
+
+	return result
+}
+
+// newBrandResult merges the brand's own description and proofs with those of its company, brand first
+func newBrandResult(brand *entity.Brand) *boycottedResult {
+	result := &boycottedResult{
+		ID:      brand.ID,
+		Name:    brand.Name,
+		Slug:    brand.Slug,
+		Images:  brand.Images,
+		Company: brand.Company,
+		Owners:  brand.Owners,
+		Type:    sourceBrand,
+	}
+
+	result.Descriptions = appendSourced(nil, sourceBrand, brand.Description)
+	result.Proofs = appendSourced(nil, sourceBrand, brand.Proof...)
+	if brand.Company != nil {
+		result.Descriptions = appendSourced(result.Descriptions, sourceCompany, brand.Company.Description)
+		result.Proofs = appendSourced(result.Proofs, sourceCompany, brand.Company.Proof...)
+	}
+
+	descriptions := make([]string, 0, len(result.Descriptions))
+	for _, description := range result.Descriptions {
+		descriptions = append(descriptions, description.Text)
+	}
+	result.Description = strings.Join(descriptions, "\n\n")
+
+	result.Proof = make([]string, 0, len(result.Proofs))
+	for _, proof := range result.Proofs {
+		result.Proof = append(result.Proof, proof.Text)
+	}
+
+	return result
+}
+
+// brandStatusAt tells whether the brand is boycotted at the given date, that is whether a company
+// holds it then in one of the roles the boycott covers
+func brandStatusAt(brand *entity.Brand, at time.Time) string {
+	for i := range brand.Owners {
+		owner := &brand.Owners[i]
+		if slices.Contains(entity.BoycottOwnershipRoles, owner.Role) && owner.IsActiveAt(at) {
+			return statusBoycotted
+		}
+	}
+
+	return statusCleared
+}
+
+// appendSourced appends the non-empty texts that are not in the list yet
+func appendSourced(list []*sourcedText, source string, texts ...string) []*sourcedText {
+	for _, text := range texts {
+		text = strings.TrimSpace(text)
+		if text == "" || containsText(list, text) {
+			continue
+		}
+
+		list = append(list, &sourcedText{Text: text, Source: source})
+	}
+
+	return list
+}
+
+func containsText(list []*sourcedText, text string) bool {
+	for _, item := range list {
+		if item.Text == text {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveDate parses the requested date, defaulting to today when it is empty
+func resolveDate(input string) (time.Time, error) {
+	if input == "" {
+		return time.Now(), nil
+	}
+
+	date, err := helper.ParseDate(input)
+	if err != nil {
+		return time.Time{}, errors.New(common.InvalidDate)
+	}
+
+	return date, nil
+}
+
+func parseOptionalDate(input string) (*time.Time, error) {
+	if input == "" {
+		return nil, nil
+	}
+
+	date, err := helper.ParseDate(input)
+	if err != nil {
+		return nil, errors.New(common.InvalidDate)
+	}
+
+	return &date, nil
+}
+
+// sameDate reports whether two optional dates fall on the same day, the time of day is not stored
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Format(helper.DateLayout) == b.Format(helper.DateLayout)
+}
+
+// parseLookupItem tells whether a lookup item is a barcode, a domain or a name and returns the keys to match it by,
+// most specific first: longer barcode prefixes before shorter ones and subdomains before their parents. A name
+// such as "Dr.Oetker" looks like a domain, so a domain is also matched as a name when none of its keys match.
+func parseLookupItem(item string) []*lookupKey {
+	var keys []*lookupKey
+	if code, ok := helper.NormalizeBarcode(item); ok {
+		// the last digit is a check digit and GS1 company prefixes are at least 6 digits long
+		for n := len(code) - 1; n >= 6; n-- {
+			keys = append(keys, &lookupKey{lookupKindBarcode, code[:n]})
+		}
+
+		return keys
+	}
+
+	trimmed := strings.TrimSpace(item)
+	if !strings.ContainsAny(trimmed, " \t") {
+		domain := helper.NormalizeDomain(trimmed)
+		if i := strings.LastIndex(domain, "."); i > 0 && len(domain)-i > 2 && !helper.IsDigits(domain[i+1:]) {
+			for _, suffix := range helper.DomainSuffixes(domain) {
+				keys = append(keys, &lookupKey{lookupKindDomain, suffix})
+			}
+		}
+	}
+
+	if key := search.TermKey(trimmed); key != "" {
+		keys = append(keys, &lookupKey{lookupKindName, key})
+	}
+
+	return keys
+}
+
+// uniqueLookupMatches drops repeated companies and brands, and alias matches when a name matched as well
+func uniqueLookupMatches(matches []*lookupMatch) []*lookupMatch {
+	hasName := false
+	for _, match := range matches {
+		if !match.Alias {
+			hasName = true
+		}
+	}
+
+	type entityKey struct {
+		source string
+		id     uint
+	}
+
+	var unique []*lookupMatch
+	seen := map[entityKey]struct{}{}
+	for _, match := range matches {
+		if hasName && match.Alias {
+			continue
+		}
+
+		key := entityKey{sourceCompany, 0}
+		if match.Brand != nil {
+			key = entityKey{sourceBrand, match.Brand.ID}
+		} else {
+			key.id = match.Company.ID
+		}
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		unique = append(unique, match)
+	}
+
+	return unique
+}
+
+func newLookupMatchResult(match *lookupMatch) *boycottedResult {
+	if match.Brand != nil {
+		return newBrandResult(match.Brand)
+	}
+
+	return newCompanyResult(match.Company)
+}
+
+// splitFilter splits a comma separated filter, dropping blank values
+func splitFilter(input string) []string {
+	var values []string
+	for _, value := range strings.Split(input, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
 
-	return config
+	return values
 }
@@ -2,9 +2,15 @@ package cloudstorage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"mime/multipart"
+	"io"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ariefro/buycut-api/config"
 	"github.com/ariefro/buycut-api/pkg/helper"
@@ -14,38 +20,25 @@ import (
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 )
 
-type UploadArgs struct {
-	File      interface{}
-	CompanyID uint
-	Slug      string
-	Config    *config.CloudinaryConfig
+type cloudinaryStorage struct {
+	cld    *cloudinary.Cloudinary
+	config *config.CloudinaryConfig
 }
 
-type UpdateArgs struct {
-	Slug   string
-	Config *config.CloudinaryConfig
-}
-
-type DeleteArgs struct {
-	CompanyID uint
-	Config    *config.CloudinaryConfig
-	Slug      string
-}
-
-type DeleteAssetsByTagArgs struct {
-	CompanyID uint
-	Config    *config.CloudinaryConfig
-}
+func NewCloudinaryStorage(cfg *config.Config) (Storage, error) {
+	cloudinaryConfig := &config.CloudinaryConfig{
+		CloudinaryCloudName:    cfg.CloudinaryCloudName,
+		CloudinaryApiKey:       cfg.CloudinaryApiKey,
+		CloudinarySecretKey:    cfg.CloudinarySecretKey,
+		CloudinaryBuycutFolder: cfg.CloudinaryBuycutFolder,
+	}
 
-type DeleteEmptyFolderArgs struct {
-	CompanyID uint
-	Config    *config.CloudinaryConfig
-}
+	cld, err := SetupCloudinary(cloudinaryConfig)
+	if err != nil {
+		return nil, err
+	}
 
-type UploadImageArgs struct {
-	CompanyID uint
-	File      *multipart.FileHeader
-	Slug      string
+	return &cloudinaryStorage{cld: cld, config: cloudinaryConfig}, nil
 }
 
 func SetupCloudinary(cfg *config.CloudinaryConfig) (*cloudinary.Cloudinary, error) {
@@ -56,72 +49,112 @@ func SetupCloudinary(cfg *config.CloudinaryConfig) (*cloudinary.Cloudinary, erro
 	return cld, nil
 }
 
-func UploadFile(args *UploadArgs) (string, error) {
-	ctx := context.Background()
-	cld, err := SetupCloudinary(args.Config)
-	if err != nil {
-		return "", err
-	}
-
+func (s *cloudinaryStorage) Upload(ctx context.Context, args *UploadArgs) (string, error) {
 	companyIDStr := strconv.FormatUint(uint64(args.CompanyID), 10)
 	uploadParams := uploader.UploadParams{
 		PublicID: args.Slug,
 		Tags:     api.CldAPIArray{companyIDStr},
-		Folder:   args.Config.CloudinaryBuycutFolder + "/" + companyIDStr,
+		Folder:   s.folder(args.CompanyID),
 	}
 
-	result, err := cld.Upload.Upload(ctx, args.File, uploadParams)
+	operation := "upload asset " + s.publicID(args.CompanyID, args.Slug)
+	result, err := s.cld.Upload.Upload(ctx, args.File, uploadParams)
 	if err != nil {
-		return "", err
+		return "", cloudinaryCallError(operation, err)
+	}
+
+	if result.Error.Message != "" {
+		return "", &cloudinaryError{operation: operation, message: result.Error.Message}
 	}
 
 	return result.SecureURL, nil
 }
 
-func DeleteFile(args *DeleteArgs) error {
-	ctx := context.Background()
-	cld, err := SetupCloudinary(args.Config)
+func (s *cloudinaryStorage) Delete(ctx context.Context, args *DeleteArgs) error {
+	destroyParams := uploader.DestroyParams{PublicID: s.publicID(args.CompanyID, args.Slug)}
+	operation := "delete asset " + destroyParams.PublicID
+	result, err := s.cld.Upload.Destroy(ctx, destroyParams)
 	if err != nil {
-		return err
+		return cloudinaryCallError(operation, err)
 	}
 
-	companyIDStr := strconv.FormatUint(uint64(args.CompanyID), 10)
-	publicID := fmt.Sprintf("%s/%s/%s", args.Config.CloudinaryBuycutFolder, companyIDStr, args.Slug)
-	destroyParams := uploader.DestroyParams{PublicID: publicID}
-	_, err = cld.Upload.Destroy(ctx, destroyParams)
-	if err != nil {
-		return err
+	// an asset that is not there is reported in the result rather than as an error
+	if result.Error.Message != "" {
+		return &cloudinaryError{operation: operation, message: result.Error.Message}
 	}
 
 	return nil
 }
 
-func DeleteAssetsByTag(args *DeleteAssetsByTagArgs) error {
-	ctx := context.Background()
-	cld, err := SetupCloudinary(args.Config)
+// Move renames an asset into the folder of another company and replaces its company tag
+func (s *cloudinaryStorage) Move(ctx context.Context, args *MoveArgs) (string, error) {
+	fromPublicID := s.publicID(args.FromCompanyID, args.FromSlug)
+	toPublicID := s.publicID(args.ToCompanyID, args.ToSlug)
+	url, err := s.rename(ctx, fromPublicID, toPublicID)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	companyIDStr := strconv.FormatUint(uint64(args.CompanyID), 10)
-	_, err = cld.Admin.DeleteAssetsByTag(ctx, admin.DeleteAssetsByTagParams{Tag: companyIDStr})
+	// an asset left with the tag of its old company would be deleted along with that company
+	if err := s.retag(ctx, args.ToCompanyID, toPublicID); err != nil {
+		if _, errRename := s.rename(ctx, toPublicID, fromPublicID); errRename != nil {
+			return "", fmt.Errorf("failed to retag asset %s: %v, and to move it back: %v", toPublicID, err, errRename)
+		}
+
+		return "", err
+	}
+
+	return url, nil
+}
+
+func (s *cloudinaryStorage) retag(ctx context.Context, companyID uint, publicID string) error {
+	operation := "retag asset " + publicID
+	result, err := s.cld.Upload.ReplaceTag(ctx, uploader.ReplaceTagParams{
+		Tag:       strconv.FormatUint(uint64(companyID), 10),
+		PublicIDs: []string{publicID},
+	})
 	if err != nil {
-		return err
+		return cloudinaryCallError(operation, err)
+	}
+
+	if result.Error.Message != "" {
+		return &cloudinaryError{operation: operation, message: result.Error.Message}
 	}
 
 	return nil
 }
 
-func DeleteEmptyFolder(args *DeleteEmptyFolderArgs) error {
-	ctx := context.Background()
-	cld, err := SetupCloudinary(args.Config)
+func (s *cloudinaryStorage) rename(ctx context.Context, fromPublicID, toPublicID string) (string, error) {
+	operation := "move asset " + fromPublicID
+	result, err := s.cld.Upload.Rename(ctx, uploader.RenameParams{
+		FromPublicID: fromPublicID,
+		ToPublicID:   toPublicID,
+		Overwrite:    api.Bool(true),
+		Invalidate:   api.Bool(true),
+	})
+	if err != nil {
+		return "", cloudinaryCallError(operation, err)
+	}
+
+	if result.Error != nil {
+		return "", &cloudinaryError{operation: operation, message: resultErrorMessage(result.Error)}
+	}
+
+	return result.SecureURL, nil
+}
+
+func (s *cloudinaryStorage) DeleteCompanyAssets(ctx context.Context, companyID uint) error {
+	companyIDStr := strconv.FormatUint(uint64(companyID), 10)
+	_, err := s.cld.Admin.DeleteAssetsByTag(ctx, admin.DeleteAssetsByTagParams{Tag: companyIDStr})
 	if err != nil {
 		return err
 	}
 
-	companyIDStr := strconv.FormatUint(uint64(args.CompanyID), 10)
-	pathFolder := fmt.Sprintf("%s/%s", args.Config.CloudinaryBuycutFolder, companyIDStr)
-	_, err = cld.Admin.DeleteFolder(ctx, admin.DeleteFolderParams{Folder: pathFolder})
+	return nil
+}
+
+func (s *cloudinaryStorage) DeleteEmptyFolder(ctx context.Context, companyID uint) error {
+	_, err := s.cld.Admin.DeleteFolder(ctx, admin.DeleteFolderParams{Folder: s.folder(companyID)})
 	if err != nil {
 		return err
 	}
@@ -129,20 +162,197 @@ func DeleteEmptyFolder(args *DeleteEmptyFolderArgs) error {
 	return nil
 }
 
-func UploadImage(ctx context.Context, args *UploadImageArgs, config *config.CloudinaryConfig) (string, error) {
-	if args.File == nil {
-		return "", nil
+func (s *cloudinaryStorage) List(ctx context.Context) ([]*Asset, error) {
+	var assets []*Asset
+	params := admin.AssetsParams{
+		AssetType:    api.Image,
+		DeliveryType: "upload",
+		Prefix:       s.config.CloudinaryBuycutFolder + "/",
+		MaxResults:   500,
 	}
 
-	if err := helper.ValidateImage(args.File); err != nil {
-		return "", err
+	for {
+		result, err := s.cld.Admin.Assets(ctx, params)
+		if err != nil {
+			return nil, cloudinaryCallError("list assets", err)
+		}
+
+		if result.Error.Message != "" {
+			return nil, &cloudinaryError{operation: "list assets", message: result.Error.Message}
+		}
+
+		for _, resource := range result.Assets {
+			asset, ok := assetFromKey(strings.TrimPrefix(resource.PublicID, params.Prefix))
+			if !ok {
+				continue
+			}
+
+			asset.URL = resource.SecureURL
+			asset.UpdatedAt = resource.CreatedAt
+			assets = append(assets, asset)
+		}
+
+		if result.NextCursor == "" {
+			return assets, nil
+		}
+
+		params.NextCursor = result.NextCursor
+	}
+}
+
+// Locate parses a delivery URL such as https://res.cloudinary.com/<cloud>/image/upload/v<version>/<public id>.<format>
+func (s *cloudinaryStorage) Locate(url string) (*Asset, bool) {
+	_, path, ok := strings.Cut(url, "/image/upload/")
+	if !ok {
+		return nil, false
+	}
+
+	if version, rest, ok := strings.Cut(path, "/"); ok && strings.HasPrefix(version, "v") && helper.IsDigits(version[1:]) {
+		path = rest
 	}
 
-	imageFile, err := args.File.Open()
+	path, ok = strings.CutPrefix(path, s.config.CloudinaryBuycutFolder+"/")
+	if !ok {
+		return nil, false
+	}
+
+	asset, ok := assetFromKey(path)
+	if !ok {
+		return nil, false
+	}
+
+	asset.URL = url
+	return asset, true
+}
+
+// PresignUpload signs the parameters of an upload to the Cloudinary upload API. Cloudinary accepts
+// a signature for an hour after its timestamp and cannot bound the file size, so the size is
+// checked once the upload is finalized.
+func (s *cloudinaryStorage) PresignUpload(ctx context.Context, args *PresignArgs) (*PresignedUpload, error) {
+	timestamp := time.Now()
+	params := url.Values{
+		"folder":    {s.folder(args.CompanyID)},
+		"public_id": {args.Slug},
+		"tags":      {strconv.FormatUint(uint64(args.CompanyID), 10)},
+		"timestamp": {strconv.FormatInt(timestamp.Unix(), 10)},
+	}
+
+	signature, err := api.SignParameters(params, s.config.CloudinarySecretKey)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	fields := map[string]string{"api_key": s.config.CloudinaryApiKey, "signature": signature}
+	for key := range params {
+		fields[key] = params.Get(key)
+	}
+
+	return &PresignedUpload{
+		URL:       fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/image/upload", s.config.CloudinaryCloudName),
+		Method:    http.MethodPost,
+		Fields:    fields,
+		ExpiresAt: timestamp.Add(time.Hour),
+	}, nil
+}
+
+func (s *cloudinaryStorage) Open(ctx context.Context, companyID uint, slug string) (io.ReadCloser, error) {
+	operation := "open asset " + s.publicID(companyID, slug)
+	result, err := s.cld.Admin.Asset(ctx, admin.AssetParams{PublicID: s.publicID(companyID, slug)})
+	if err != nil {
+		return nil, cloudinaryCallError(operation, err)
+	}
+
+	if result.Error.Message != "" {
+		if strings.Contains(strings.ToLower(result.Error.Message), "not found") {
+			return nil, ErrAssetNotFound
+		}
+
+		return nil, &cloudinaryError{operation: operation, message: result.Error.Message}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, result.SecureURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		if response.StatusCode == http.StatusNotFound {
+			return nil, ErrAssetNotFound
+		}
+
+		return nil, &cloudinaryError{operation: operation, message: response.Status, statusCode: response.StatusCode}
+	}
+
+	return response.Body, nil
+}
+
+func (s *cloudinaryStorage) folder(companyID uint) string {
+	return fmt.Sprintf("%s/%d", s.config.CloudinaryBuycutFolder, companyID)
+}
+
+func (s *cloudinaryStorage) publicID(companyID uint, slug string) string {
+	return fmt.Sprintf("%s/%s", s.folder(companyID), slug)
+}
+
+// cloudinaryError is a failure Cloudinary reported in its response. The SDK hands over the body
+// without the status code, so rate limits and server side errors are told apart by their message.
+type cloudinaryError struct {
+	operation  string
+	message    string
+	statusCode int
+}
+
+func (err *cloudinaryError) Error() string {
+	return fmt.Sprintf("failed to %s: %s", err.operation, err.message)
+}
+
+// rateLimited tells a request Cloudinary turned down without acting on it
+func (err *cloudinaryError) rateLimited() bool {
+	message := strings.ToLower(err.message)
+	return err.statusCode == http.StatusTooManyRequests || err.statusCode == 420 ||
+		strings.Contains(message, "rate limit") || strings.Contains(message, "too many requests")
+}
+
+// transient tells failures worth another attempt, rate limits and server side errors
+func (err *cloudinaryError) transient() bool {
+	if err.rateLimited() || err.statusCode >= http.StatusInternalServerError {
+		return true
+	}
+
+	message := strings.ToLower(err.message)
+	for _, hint := range []string{"internal server error", "bad gateway", "service unavailable", "gateway timeout", "timed out", "try again"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cloudinaryCallError turns the error of an SDK call into a cloudinaryError when Cloudinary answered
+// with something other than JSON, which is what its gateway sends along with a server side error
+func cloudinaryCallError(operation string, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &cloudinaryError{operation: operation, message: "unexpected response", statusCode: http.StatusBadGateway}
+	}
+
+	return err
+}
+
+// resultErrorMessage reads the error of results the SDK leaves untyped
+func resultErrorMessage(resultErr interface{}) string {
+	if fields, ok := resultErr.(map[string]interface{}); ok {
+		if message, ok := fields["message"].(string); ok {
+			return message
+		}
 	}
-	defer imageFile.Close()
 
-	return UploadFile(&UploadArgs{File: imageFile, Slug: args.Slug, CompanyID: args.CompanyID, Config: config})
+	return fmt.Sprint(resultErr)
 }
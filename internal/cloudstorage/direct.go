@@ -0,0 +1,94 @@
+package cloudstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ariefro/buycut-api/config"
+	"github.com/ariefro/buycut-api/pkg/common"
+	"github.com/ariefro/buycut-api/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+// imageUpload is the variant a direct upload is stored under until it is finalized
+const imageUpload = "upload"
+
+// PresignedUploadTTL is how long the parameters of a direct upload stay valid
+const PresignedUploadTTL = 15 * time.Minute
+
+type PresignArgs struct {
+	CompanyID uint
+	Slug      string
+	MaxBytes  int64
+	ExpiresAt time.Time
+}
+
+// PresignedUpload is a multipart form POST the client sends with its file in the "file" field
+type PresignedUpload struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+type DirectUploadArgs struct {
+	CompanyID uint
+	Slug      string
+	Limits    *config.ImageLimits
+}
+
+// PresignImageUpload issues the parameters to upload the image of an entity straight to the storage.
+// The file lands next to the image variants and is only used once it is finalized.
+func PresignImageUpload(ctx context.Context, storage Storage, args *DirectUploadArgs) (*PresignedUpload, error) {
+	upload, err := storage.PresignUpload(ctx, &PresignArgs{
+		CompanyID: args.CompanyID,
+		Slug:      VariantSlug(args.Slug, imageUpload),
+		MaxBytes:  int64(args.Limits.MaxSizeKB) * 1024,
+		ExpiresAt: time.Now().Add(PresignedUploadTTL),
+	})
+	if errors.Is(err, ErrPresignNotSupported) {
+		return nil, errors.New(common.DirectUploadNotSupported)
+	}
+
+	return upload, err
+}
+
+// FinalizeImageUpload validates a direct upload, stores its variants and deletes the upload.
+// It returns the URL of every variant by name.
+func FinalizeImageUpload(ctx context.Context, storage Storage, args *DirectUploadArgs) (map[string]string, error) {
+	slug := VariantSlug(args.Slug, imageUpload)
+	file, err := storage.Open(ctx, args.CompanyID, slug)
+	if errors.Is(err, ErrAssetNotFound) {
+		return nil, errors.New(common.UploadedImageNotFound)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// the storage may not have enforced the size limit, never read more than it allows
+	maxSize := int64(args.Limits.MaxSizeKB) * 1024
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := helper.ValidateImageData(data, args.Limits); err != nil {
+		return nil, err
+	}
+
+	images, err := storeImage(ctx, storage, args.CompanyID, args.Slug, data, args.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.Delete(ctx, &DeleteArgs{CompanyID: args.CompanyID, Slug: slug}); err != nil {
+		// the reconciliation removes it later, the image itself is in place
+		log.Errorln("failed to remove finalized upload:", err)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,156 @@
+package cloudstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/ariefro/buycut-api/pkg/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ImageFetchTimeout bounds fetching an image from a remote URL, redirects included
+	ImageFetchTimeout = 10 * time.Second
+	// MaxImageFetchRedirects is how many redirects are followed from an image source URL
+	MaxImageFetchRedirects = 3
+)
+
+var errAddressNotAllowed = errors.New("address not allowed")
+
+// blockedPrefixes are ranges that are not private by the book but must not be reached either
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64, may embed a private IPv4 address
+}
+
+// imageFetchClient only connects to public addresses. The address is checked when the connection
+// is made, after name resolution, so a host name cannot resolve to an internal address between a
+// check and the request, and every redirect is checked the same way.
+var imageFetchClient = &http.Client{
+	Timeout: ImageFetchTimeout,
+	Transport: &http.Transport{
+		// a proxy from the environment would make the dialed address that of the proxy
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: ImageFetchTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil || !isPublicAddr(addrPort.Addr()) {
+					return errAddressNotAllowed
+				}
+
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   ImageFetchTimeout,
+		ResponseHeaderTimeout: ImageFetchTimeout,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if len(via) > MaxImageFetchRedirects {
+			return errors.New(common.ImageSourceUnreachable)
+		}
+
+		return checkImageSourceURL(request.URL)
+	},
+}
+
+// fetchImage downloads the image at a remote URL, reading at most maxSize bytes
+func fetchImage(ctx context.Context, sourceURL string, maxSize int64) ([]byte, error) {
+	parsed, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, errors.New(common.InvalidImageSourceURL)
+	}
+
+	if err := checkImageSourceURL(parsed); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, errors.New(common.InvalidImageSourceURL)
+	}
+	request.Header.Set("Accept", "image/*")
+
+	response, err := imageFetchClient.Do(request)
+	if err != nil {
+		return nil, fetchError(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New(common.ImageSourceUnreachable)
+	}
+
+	if response.ContentLength > maxSize {
+		return nil, errors.New(common.FileSizeIsTooLarge)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, fetchError(err)
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, errors.New(common.FileSizeIsTooLarge)
+	}
+
+	return data, nil
+}
+
+// checkImageSourceURL accepts absolute http and https URLs without credentials. Hosts written as
+// an IP address are checked right away, host names when they are dialed.
+func checkImageSourceURL(sourceURL *url.URL) error {
+	if (sourceURL.Scheme != "http" && sourceURL.Scheme != "https") || sourceURL.Hostname() == "" || sourceURL.User != nil {
+		return errors.New(common.InvalidImageSourceURL)
+	}
+
+	if addr, err := netip.ParseAddr(sourceURL.Hostname()); err == nil && !isPublicAddr(addr) {
+		return errors.New(common.ImageSourceNotAllowed)
+	}
+
+	return nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func fetchError(err error) error {
+	if errors.Is(err, errAddressNotAllowed) {
+		return errors.New(common.ImageSourceNotAllowed)
+	}
+
+	// errors of redirects the client refused are returned as they are
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		switch urlErr.Err.Error() {
+		case common.InvalidImageSourceURL, common.ImageSourceNotAllowed, common.ImageSourceUnreachable:
+			return urlErr.Err
+		}
+	}
+
+	log.Warnln("failed to fetch image:", err)
+	return errors.New(common.ImageSourceUnreachable)
+}
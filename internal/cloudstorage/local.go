@@ -0,0 +1,256 @@
+package cloudstorage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ariefro/buycut-api/config"
+)
+
+// localStorage keeps images on the disk of the server, they are served by Fiber under the base URL
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalStorage(cfg *config.Config) (Storage, error) {
+	if err := os.MkdirAll(cfg.LocalStorageDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &localStorage{dir: cfg.LocalStorageDir, baseURL: strings.TrimSuffix(cfg.LocalStorageBaseURL, "/")}, nil
+}
+
+// LocalMountPath is the path the images of the local driver are served under, the path of
+// LOCAL_STORAGE_BASE_URL whether it is a path or a full URL
+func LocalMountPath(cfg *config.Config) string {
+	mountPath := cfg.LocalStorageBaseURL
+	if baseURL, err := url.Parse(mountPath); err == nil {
+		mountPath = baseURL.Path
+	}
+
+	return "/" + strings.Trim(mountPath, "/")
+}
+
+func (s *localStorage) Upload(ctx context.Context, args *UploadArgs) (string, error) {
+	extension, _, file, err := sniffExtension(args.File)
+	if err != nil {
+		return "", err
+	}
+
+	// an image replaced by one of another format must not leave the old file behind
+	if err := s.removeAll(args.CompanyID, args.Slug); err != nil {
+		return "", err
+	}
+
+	key := objectKey(args.CompanyID, args.Slug, extension)
+	if err := os.MkdirAll(filepath.Dir(s.path(key)), 0o755); err != nil {
+		return "", err
+	}
+
+	// write to a temporary file first so a failed upload never leaves half an image in place
+	tmp, err := os.CreateTemp(filepath.Dir(s.path(key)), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return "", err
+	}
+
+	return s.url(key), nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, args *DeleteArgs) error {
+	return s.removeAll(args.CompanyID, args.Slug)
+}
+
+func (s *localStorage) Move(ctx context.Context, args *MoveArgs) (string, error) {
+	from, err := s.find(args.FromCompanyID, args.FromSlug)
+	if err != nil {
+		return "", err
+	}
+
+	if len(from) == 0 {
+		return "", os.ErrNotExist
+	}
+
+	if err := s.removeAll(args.ToCompanyID, args.ToSlug); err != nil {
+		return "", err
+	}
+
+	key := objectKey(args.ToCompanyID, args.ToSlug, path.Ext(from[0]))
+	if err := os.MkdirAll(filepath.Dir(s.path(key)), 0o755); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(s.path(from[0]), s.path(key)); err != nil {
+		return "", err
+	}
+
+	return s.url(key), nil
+}
+
+func (s *localStorage) DeleteCompanyAssets(ctx context.Context, companyID uint) error {
+	entries, err := os.ReadDir(s.companyDir(companyID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.companyDir(companyID), entry.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *localStorage) DeleteEmptyFolder(ctx context.Context, companyID uint) error {
+	// os.Remove refuses to delete a folder that still holds files
+	if err := os.Remove(s.companyDir(companyID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *localStorage) List(ctx context.Context) ([]*Asset, error) {
+	var assets []*Asset
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return err
+		}
+
+		key, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+
+		asset, ok := assetFromKey(filepath.ToSlash(key))
+		if !ok {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		asset.URL = s.url(filepath.ToSlash(key))
+		asset.UpdatedAt = info.ModTime()
+		assets = append(assets, asset)
+
+		return nil
+	})
+
+	return assets, err
+}
+
+func (s *localStorage) Locate(url string) (*Asset, bool) {
+	key, ok := strings.CutPrefix(url, s.baseURL+"/")
+	if !ok {
+		return nil, false
+	}
+
+	asset, ok := assetFromKey(key)
+	if !ok {
+		return nil, false
+	}
+
+	asset.URL = url
+	return asset, true
+}
+
+// PresignUpload is not supported, files on the disk of the server can only be uploaded through the API
+func (s *localStorage) PresignUpload(ctx context.Context, args *PresignArgs) (*PresignedUpload, error) {
+	return nil, ErrPresignNotSupported
+}
+
+func (s *localStorage) Open(ctx context.Context, companyID uint, slug string) (io.ReadCloser, error) {
+	keys, err := s.find(companyID, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrAssetNotFound
+	}
+
+	return os.Open(s.path(keys[0]))
+}
+
+// find returns the keys of the files stored for the slug, normally there is one at most
+func (s *localStorage) find(companyID uint, slug string) ([]string, error) {
+	prefix := objectPrefix(companyID, slug)
+	entries, err := os.ReadDir(s.companyDir(companyID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		key := path.Join(strconv.FormatUint(uint64(companyID), 10), entry.Name())
+		if !entry.IsDir() && strings.HasPrefix(key, prefix) && !strings.Contains(key[len(prefix):], ".") {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *localStorage) removeAll(companyID uint, slug string) error {
+	keys, err := s.find(companyID, slug)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *localStorage) companyDir(companyID uint) string {
+	return filepath.Join(s.dir, strconv.FormatUint(uint64(companyID), 10))
+}
+
+func (s *localStorage) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *localStorage) url(key string) string {
+	return s.baseURL + "/" + key
+}
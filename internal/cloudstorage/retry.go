@@ -0,0 +1,235 @@
+package cloudstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+type RetryOptions struct {
+	// Timeout bounds every attempt of an operation, zero leaves attempts unbounded
+	Timeout time.Duration
+	// MaxRetries is how many times a transient failure is retried after the first attempt
+	MaxRetries int
+	// Backoff is the wait before the first retry, it doubles on every retry after that
+	Backoff time.Duration
+}
+
+// retryStorage bounds every call of the storage it wraps with a timeout and retries transient failures
+type retryStorage struct {
+	storage Storage
+	options RetryOptions
+}
+
+func withRetry(storage Storage, options RetryOptions) Storage {
+	return &retryStorage{storage: storage, options: options}
+}
+
+func (s *retryStorage) Upload(ctx context.Context, args *UploadArgs) (string, error) {
+	// the file can only be sent again when it can be rewound
+	seeker, rewindable := args.File.(io.Seeker)
+	var start int64
+	if rewindable {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			rewindable = false
+		}
+
+		start = offset
+	}
+
+	var url string
+	attempt := 0
+	err := s.do(ctx, "upload", func(ctx context.Context) (bool, error) {
+		if attempt > 0 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return false, err
+			}
+		}
+		attempt++
+
+		var err error
+		url, err = s.storage.Upload(ctx, args)
+		return rewindable, err
+	})
+
+	return url, err
+}
+
+func (s *retryStorage) Delete(ctx context.Context, args *DeleteArgs) error {
+	return s.do(ctx, "delete", func(ctx context.Context) (bool, error) {
+		return true, s.storage.Delete(ctx, args)
+	})
+}
+
+// Move is not idempotent: once the asset has moved, running it again fails to find the asset. It is
+// only retried when the storage turned it down, a response lost on the way may follow a move that happened.
+func (s *retryStorage) Move(ctx context.Context, args *MoveArgs) (string, error) {
+	var url string
+	err := s.do(ctx, "move", func(ctx context.Context) (bool, error) {
+		var err error
+		url, err = s.storage.Move(ctx, args)
+		return notApplied(err), err
+	})
+
+	return url, err
+}
+
+func (s *retryStorage) DeleteCompanyAssets(ctx context.Context, companyID uint) error {
+	return s.do(ctx, "delete company assets", func(ctx context.Context) (bool, error) {
+		return true, s.storage.DeleteCompanyAssets(ctx, companyID)
+	})
+}
+
+func (s *retryStorage) DeleteEmptyFolder(ctx context.Context, companyID uint) error {
+	return s.do(ctx, "delete empty folder", func(ctx context.Context) (bool, error) {
+		return true, s.storage.DeleteEmptyFolder(ctx, companyID)
+	})
+}
+
+func (s *retryStorage) List(ctx context.Context) ([]*Asset, error) {
+	var assets []*Asset
+	err := s.do(ctx, "list", func(ctx context.Context) (bool, error) {
+		var err error
+		assets, err = s.storage.List(ctx)
+		return true, err
+	})
+
+	return assets, err
+}
+
+func (s *retryStorage) Locate(url string) (*Asset, bool) {
+	return s.storage.Locate(url)
+}
+
+func (s *retryStorage) PresignUpload(ctx context.Context, args *PresignArgs) (*PresignedUpload, error) {
+	var upload *PresignedUpload
+	err := s.do(ctx, "presign upload", func(ctx context.Context) (bool, error) {
+		var err error
+		upload, err = s.storage.PresignUpload(ctx, args)
+		return true, err
+	})
+
+	return upload, err
+}
+
+// Open bounds opening and reading the file together with one timeout, the file is read after the
+// attempt that opened it returns so it cannot be bound to the context of that attempt
+func (s *retryStorage) Open(ctx context.Context, companyID uint, slug string) (io.ReadCloser, error) {
+	openCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.options.Timeout > 0 {
+		openCtx, cancel = context.WithTimeout(ctx, s.options.Timeout)
+	}
+
+	var file io.ReadCloser
+	err := s.do(ctx, "open", func(context.Context) (bool, error) {
+		var err error
+		file, err = s.storage.Open(openCtx, companyID, slug)
+		return true, err
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &cancelOnClose{ReadCloser: file, cancel: cancel}, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (file *cancelOnClose) Close() error {
+	defer file.cancel()
+	return file.ReadCloser.Close()
+}
+
+// do runs the operation until it succeeds, fails for good or runs out of retries. The operation
+// reports whether it may be run again.
+func (s *retryStorage) do(ctx context.Context, name string, operation func(ctx context.Context) (bool, error)) error {
+	backoff := s.options.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := s.attempt(ctx, operation)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || attempt >= s.options.MaxRetries || ctx.Err() != nil || !isTransient(err) {
+			return err
+		}
+
+		// full jitter keeps retries of concurrent requests from arriving together
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		log.Warnf("storage %s failed, retrying in %s: %v", name, wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
+
+func (s *retryStorage) attempt(ctx context.Context, operation func(ctx context.Context) (bool, error)) (bool, error) {
+	if s.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.options.Timeout)
+		defer cancel()
+	}
+
+	return operation(ctx)
+}
+
+// isTransient tells failures worth another attempt, such as timeouts, dropped connections and
+// server side errors, from those that would fail again
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var cldErr *cloudinaryError
+	if errors.As(err, &cldErr) {
+		return cldErr.transient()
+	}
+
+	response := minio.ToErrorResponse(err)
+	return response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests
+}
+
+// notApplied tells failures that prove the storage did nothing: the connection was refused or the
+// request was turned down for going over a rate limit
+func notApplied(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var cldErr *cloudinaryError
+	if errors.As(err, &cldErr) {
+		return cldErr.rateLimited()
+	}
+
+	statusCode := minio.ToErrorResponse(err).StatusCode
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
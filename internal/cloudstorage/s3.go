@@ -0,0 +1,242 @@
+package cloudstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ariefro/buycut-api/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Storage keeps images in a bucket of any S3 compatible service, such as MinIO
+type s3Storage struct {
+	client  *minio.Client
+	bucket  string
+	baseURL string
+}
+
+func NewS3Storage(cfg *config.Config) (Storage, error) {
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+		// retries are left to the storage wrapper so their number and backoff stay configurable
+		MaxRetries: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimSuffix(cfg.S3PublicBaseURL, "/")
+	if baseURL == "" {
+		scheme := "http"
+		if cfg.S3UseSSL {
+			scheme = "https"
+		}
+
+		baseURL = fmt.Sprintf("%s://%s/%s", scheme, cfg.S3Endpoint, cfg.S3Bucket)
+	}
+
+	return &s3Storage{client: client, bucket: cfg.S3Bucket, baseURL: baseURL}, nil
+}
+
+func (s *s3Storage) Upload(ctx context.Context, args *UploadArgs) (string, error) {
+	extension, contentType, file, err := sniffExtension(args.File)
+	if err != nil {
+		return "", err
+	}
+
+	key := objectKey(args.CompanyID, args.Slug, extension)
+	if _, err := s.client.PutObject(ctx, s.bucket, key, file, -1, minio.PutObjectOptions{ContentType: contentType}); err != nil {
+		return "", err
+	}
+
+	// an image replaced by one of another format must not leave the old object behind
+	if err := s.removeAll(ctx, args.CompanyID, args.Slug, key); err != nil {
+		return "", err
+	}
+
+	return s.url(key), nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, args *DeleteArgs) error {
+	return s.removeAll(ctx, args.CompanyID, args.Slug, "")
+}
+
+// Move copies the object to its new key and deletes the original, S3 has no rename
+func (s *s3Storage) Move(ctx context.Context, args *MoveArgs) (string, error) {
+	from, err := s.find(ctx, args.FromCompanyID, args.FromSlug)
+	if err != nil {
+		return "", err
+	}
+
+	if len(from) == 0 {
+		return "", fmt.Errorf("failed to move asset %s: not found", objectPrefix(args.FromCompanyID, args.FromSlug))
+	}
+
+	key := objectKey(args.ToCompanyID, args.ToSlug, from[0][strings.LastIndex(from[0], "."):])
+	if _, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: key},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: from[0]},
+	); err != nil {
+		return "", err
+	}
+
+	if err := s.removeAll(ctx, args.ToCompanyID, args.ToSlug, key); err != nil {
+		return "", err
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, from[0], minio.RemoveObjectOptions{}); err != nil {
+		return "", err
+	}
+
+	return s.url(key), nil
+}
+
+func (s *s3Storage) DeleteCompanyAssets(ctx context.Context, companyID uint) error {
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    strconv.FormatUint(uint64(companyID), 10) + "/",
+		Recursive: true,
+	})
+
+	for object := range objects {
+		if object.Err != nil {
+			return object.Err
+		}
+
+		if err := s.client.RemoveObject(ctx, s.bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteEmptyFolder has nothing to do, folders of a bucket only exist through the keys in them
+func (s *s3Storage) DeleteEmptyFolder(ctx context.Context, companyID uint) error {
+	return nil
+}
+
+func (s *s3Storage) List(ctx context.Context) ([]*Asset, error) {
+	var assets []*Asset
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		asset, ok := assetFromKey(object.Key)
+		if !ok {
+			continue
+		}
+
+		asset.URL = s.url(object.Key)
+		asset.UpdatedAt = object.LastModified
+		assets = append(assets, asset)
+	}
+
+	return assets, nil
+}
+
+func (s *s3Storage) Locate(url string) (*Asset, bool) {
+	key, ok := strings.CutPrefix(url, s.baseURL+"/")
+	if !ok {
+		return nil, false
+	}
+
+	asset, ok := assetFromKey(key)
+	if !ok {
+		return nil, false
+	}
+
+	asset.URL = url
+	return asset, true
+}
+
+// PresignUpload issues a presigned POST policy bound to the key of the upload and to the size limit
+func (s *s3Storage) PresignUpload(ctx context.Context, args *PresignArgs) (*PresignedUpload, error) {
+	policy := minio.NewPostPolicy()
+	if err := policy.SetBucket(s.bucket); err != nil {
+		return nil, err
+	}
+
+	// the content of a direct upload is unknown until it is finalized
+	if err := policy.SetKey(objectKey(args.CompanyID, args.Slug, ".bin")); err != nil {
+		return nil, err
+	}
+
+	if err := policy.SetExpires(args.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	if err := policy.SetContentLengthRange(1, args.MaxBytes); err != nil {
+		return nil, err
+	}
+
+	url, fields, err := s.client.PresignedPostPolicy(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedUpload{URL: url.String(), Method: http.MethodPost, Fields: fields, ExpiresAt: args.ExpiresAt}, nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, companyID uint, slug string) (io.ReadCloser, error) {
+	keys, err := s.find(ctx, companyID, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrAssetNotFound
+	}
+
+	return s.client.GetObject(ctx, s.bucket, keys[0], minio.GetObjectOptions{})
+}
+
+// find returns the keys of the objects stored for the slug, normally there is one at most
+func (s *s3Storage) find(ctx context.Context, companyID uint, slug string) ([]string, error) {
+	prefix := objectPrefix(companyID, slug)
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+
+	var keys []string
+	for object := range objects {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		if !strings.Contains(object.Key[len(prefix):], ".") {
+			keys = append(keys, object.Key)
+		}
+	}
+
+	return keys, nil
+}
+
+// removeAll deletes the objects stored for the slug except the one to keep
+func (s *s3Storage) removeAll(ctx context.Context, companyID uint, slug, keep string) error {
+	keys, err := s.find(ctx, companyID, slug)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key == keep {
+			continue
+		}
+
+		if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *s3Storage) url(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,383 @@
+package cloudstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ariefro/buycut-api/config"
+	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/pkg/common"
+	"github.com/ariefro/buycut-api/pkg/helper"
+	"github.com/ariefro/buycut-api/pkg/imaging"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DriverCloudinary = "cloudinary"
+	DriverLocal      = "local"
+	DriverS3         = "s3"
+)
+
+// Storage keeps the images of companies and brands. An image is addressed by the company it
+// belongs to and a slug, so every company has a folder of its own.
+type Storage interface {
+	// Upload stores the file and returns its public URL
+	Upload(ctx context.Context, args *UploadArgs) (string, error)
+	Delete(ctx context.Context, args *DeleteArgs) error
+	// Move relocates an image to another company or slug and returns its new public URL
+	Move(ctx context.Context, args *MoveArgs) (string, error)
+	// DeleteCompanyAssets deletes every image stored in the folder of a company
+	DeleteCompanyAssets(ctx context.Context, companyID uint) error
+	DeleteEmptyFolder(ctx context.Context, companyID uint) error
+	// List returns every asset in the storage folder
+	List(ctx context.Context) ([]*Asset, error)
+	// Locate returns the asset a URL returned by the storage points to
+	Locate(url string) (*Asset, bool)
+	// PresignUpload returns what a client needs to upload a file straight to the storage,
+	// ErrPresignNotSupported when the driver cannot take direct uploads
+	PresignUpload(ctx context.Context, args *PresignArgs) (*PresignedUpload, error)
+	// Open reads a stored file, ErrAssetNotFound when there is none
+	Open(ctx context.Context, companyID uint, slug string) (io.ReadCloser, error)
+}
+
+var (
+	ErrPresignNotSupported = errors.New("storage driver does not support direct uploads")
+	ErrAssetNotFound       = errors.New("asset not found")
+)
+
+// Asset is an image kept in the storage, its slug includes the name of the variant
+type Asset struct {
+	CompanyID uint      `json:"company_id"`
+	Slug      string    `json:"slug"`
+	URL       string    `json:"url"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Key identifies the asset whatever driver keeps it
+func (asset *Asset) Key() string {
+	return fmt.Sprintf("%d/%s", asset.CompanyID, asset.Slug)
+}
+
+// assetFromKey parses a <company id>/<slug> key, the extension of the file is dropped
+func assetFromKey(key string) (*Asset, bool) {
+	companyIDStr, name, ok := strings.Cut(key, "/")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return nil, false
+	}
+
+	companyID, err := strconv.ParseUint(companyIDStr, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name = name[:i]
+	}
+
+	return &Asset{CompanyID: uint(companyID), Slug: name}, true
+}
+
+type UploadArgs struct {
+	File      io.Reader
+	CompanyID uint
+	Slug      string
+}
+
+type DeleteArgs struct {
+	CompanyID uint
+	Slug      string
+}
+
+type MoveArgs struct {
+	FromCompanyID uint
+	FromSlug      string
+	ToCompanyID   uint
+	ToSlug        string
+}
+
+// Reverse returns the arguments that move the asset back to where it came from
+func (args *MoveArgs) Reverse() *MoveArgs {
+	return &MoveArgs{
+		FromCompanyID: args.ToCompanyID,
+		FromSlug:      args.ToSlug,
+		ToCompanyID:   args.FromCompanyID,
+		ToSlug:        args.FromSlug,
+	}
+}
+
+type UploadImageArgs struct {
+	CompanyID uint
+	File      *multipart.FileHeader
+	// SourceURL is fetched by the server when no file is uploaded
+	SourceURL string
+	Slug      string
+	Limits    *config.ImageLimits
+}
+
+// NewStorage returns the driver chosen by STORAGE_DRIVER, Cloudinary when it is not set. It is built
+// once at startup and every call through it is bounded by STORAGE_TIMEOUT and retried on transient failures.
+func NewStorage(cfg *config.Config) Storage {
+	var storage Storage
+	var err error
+	switch cfg.StorageDriver {
+	case "", DriverCloudinary:
+		storage, err = NewCloudinaryStorage(cfg)
+	case DriverLocal:
+		storage, err = NewLocalStorage(cfg)
+	case DriverS3:
+		storage, err = NewS3Storage(cfg)
+	default:
+		err = fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+
+	if err != nil {
+		log.Fatalf("failed to set up storage: %v", err)
+	}
+
+	return withRetry(storage, RetryOptions{
+		Timeout:    cfg.StorageTimeout,
+		MaxRetries: cfg.StorageMaxRetries,
+		Backoff:    cfg.StorageRetryBackoff,
+	})
+}
+
+// ImageSizes are the boxes, in pixels, the variants of an uploaded image are scaled to fit
+var ImageSizes = []uint{64, 256, 1024}
+
+// VariantSlug is the slug an image variant is stored under, the original keeps the slug of its entity
+func VariantSlug(slug, variant string) string {
+	if variant == entity.ImageOriginal {
+		return slug
+	}
+
+	return slug + "_" + variant
+}
+
+// UploadImage validates an uploaded image, normalizes it into sized variants and stores them.
+// It returns the URL of every variant by name, no file and no source URL store nothing.
+func UploadImage(ctx context.Context, storage Storage, args *UploadImageArgs) (map[string]string, error) {
+	if args.File == nil && args.SourceURL != "" {
+		data, err := fetchImage(ctx, args.SourceURL, int64(args.Limits.MaxSizeKB)*1024)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := helper.ValidateImageData(data, args.Limits); err != nil {
+			return nil, err
+		}
+
+		return storeImage(ctx, storage, args.CompanyID, args.Slug, data, args.Limits)
+	}
+
+	if args.File == nil {
+		return nil, nil
+	}
+
+	if err := helper.ValidateImage(args.File, args.Limits); err != nil {
+		return nil, err
+	}
+
+	imageFile, err := args.File.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer imageFile.Close()
+
+	data, err := io.ReadAll(imageFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return storeImage(ctx, storage, args.CompanyID, args.Slug, data, args.Limits)
+}
+
+// storeImage normalizes a validated image into its variants and stores them. An SVG is stored
+// sanitized, along with PNG variants rendered from it when the limits ask for them. The variants are
+// stored under a new version of the slug, so the image a row points at stays in place until the row
+// is switched to the new one.
+func storeImage(ctx context.Context, storage Storage, companyID uint, slug string, data []byte, limits *config.ImageLimits) (map[string]string, error) {
+	files, err := imageVariants(data, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	slug = versionedSlug(slug)
+	images := make(map[string]string, len(files))
+	for _, name := range names {
+		url, err := storage.Upload(ctx, &UploadArgs{
+			File:      bytes.NewReader(files[name]),
+			CompanyID: companyID,
+			Slug:      VariantSlug(slug, name),
+		})
+		if err != nil {
+			// an image is only usable with all of its variants
+			for uploaded := range images {
+				if errDelete := storage.Delete(ctx, &DeleteArgs{CompanyID: companyID, Slug: VariantSlug(slug, uploaded)}); errDelete != nil {
+					log.Errorln("failed to remove uploaded image variant:", errDelete)
+				}
+			}
+
+			return nil, err
+		}
+
+		images[name] = url
+	}
+
+	return images, nil
+}
+
+// versionedSlug tells apart the uploads of an image stored under the same slug
+func versionedSlug(slug string) string {
+	return slug + "_v" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// imageVariants encodes the files stored for an image by the name of their variant
+func imageVariants(data []byte, limits *config.ImageLimits) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	var variants []*imaging.Variant
+	var err error
+	if imaging.IsSVG(data) {
+		sanitized, err := imaging.SanitizeSVG(data)
+		if err != nil {
+			return nil, errors.New(common.InvalidSVGFile)
+		}
+
+		files[entity.ImageSVG] = sanitized
+		if !limits.RasterizeSVG {
+			return files, nil
+		}
+
+		if variants, err = imaging.RasterizeSVG(sanitized, ImageSizes); err != nil {
+			log.Warnln("failed to rasterize svg:", err)
+			return nil, errors.New(common.InvalidSVGFile)
+		}
+	} else if variants, err = imaging.Process(data, ImageSizes); err != nil {
+		return nil, errors.New(common.InvalidImageFile)
+	}
+
+	for _, variant := range variants {
+		files[strconv.FormatUint(uint64(variant.Size), 10)] = variant.Data
+	}
+
+	return files, nil
+}
+
+// DeleteImages deletes the stored files of the image variants listed in images. A failure does not
+// stop the other variants from being deleted, the first one is returned.
+func DeleteImages(ctx context.Context, storage Storage, images map[string]string) error {
+	var firstErr error
+	for _, variant := range sortedNames(images) {
+		asset, ok := storage.Locate(images[variant])
+		if !ok {
+			// not a file of this storage, there is nothing to delete
+			continue
+		}
+
+		if err := storage.Delete(ctx, &DeleteArgs{CompanyID: asset.CompanyID, Slug: asset.Slug}); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// MoveImage moves the variants of an image listed in images and returns their new URLs. The slug
+// of each variant keeps what follows args.FromSlug, so the version and the variant name survive.
+// When one of them fails the variants already moved are moved back.
+func MoveImage(ctx context.Context, storage Storage, args *MoveArgs, images map[string]string) (map[string]string, error) {
+	moved := make(map[string]string, len(images))
+	for _, variant := range sortedNames(images) {
+		fromSlug := VariantSlug(args.FromSlug, variant)
+		if asset, ok := storage.Locate(images[variant]); ok && strings.HasPrefix(asset.Slug, args.FromSlug) {
+			fromSlug = asset.Slug
+		}
+
+		variantArgs := &MoveArgs{
+			FromCompanyID: args.FromCompanyID,
+			FromSlug:      fromSlug,
+			ToCompanyID:   args.ToCompanyID,
+			ToSlug:        args.ToSlug + strings.TrimPrefix(fromSlug, args.FromSlug),
+		}
+
+		url, err := storage.Move(ctx, variantArgs)
+		if err != nil {
+			if _, errMove := MoveImage(ctx, storage, args.Reverse(), moved); errMove != nil {
+				log.Errorln("failed to move image variants back:", errMove)
+			}
+
+			return nil, err
+		}
+
+		moved[variant] = url
+	}
+
+	return moved, nil
+}
+
+func sortedNames(images map[string]string) []string {
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// objectKey is where the local and S3 drivers keep an image, relative to their root
+func objectKey(companyID uint, slug, extension string) string {
+	return objectPrefix(companyID, slug) + extension[1:]
+}
+
+// objectPrefix matches the key of an image whatever its extension is
+func objectPrefix(companyID uint, slug string) string {
+	return fmt.Sprintf("%d/%s.", companyID, slug)
+}
+
+// sniffExtension reads the start of the file to pick the extension its content type calls for,
+// and returns a reader that still yields the whole file
+func sniffExtension(file io.Reader) (string, string, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", nil, err
+	}
+
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	// content sniffing takes any XML for text, a sanitized SVG starts with its root element
+	if bytes.HasPrefix(head, []byte("<svg ")) {
+		contentType = "image/svg+xml"
+	}
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		extension = ".bin"
+	}
+
+	return extension, contentType, io.MultiReader(bytes.NewReader(head), file), nil
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/bmp":     ".bmp",
+	"image/svg+xml": ".svg",
+}
@@ -16,6 +16,8 @@ type Controller interface {
 	FindOneByID(c *fiber.Ctx) error
 	Update(c *fiber.Ctx) error
 	Delete(c *fiber.Ctx) error
+	PresignImageUpload(c *fiber.Ctx) error
+	FinalizeImageUpload(c *fiber.Ctx) error
 }
 
 type controller struct {
@@ -30,6 +32,13 @@ type createCompanyRequest struct {
 	Name        string   `form:"name" validate:"required~nama perusahaan tidak boleh kosong"`
 	Description string   `form:"description" validate:"required~deskripsi tidak boleh kosong"`
 	Proof       []string `form:"proof" validate:"required~bukti tidak boleh kosong"`
+	Aliases     []string `form:"aliases"`
+	Domains     []string `form:"domains"`
+	Country     string   `form:"country"`
+	// BarcodePrefixes are the GS1 company prefixes at the start of the company's product barcodes
+	BarcodePrefixes []string `form:"barcode_prefixes"`
+	// ImageSourceURL is fetched by the server when no image file is uploaded
+	ImageSourceURL string `form:"image_source_url"`
 }
 
 type createCompanyArgs struct {
@@ -42,11 +51,19 @@ type getCompaniesRequest struct {
 }
 
 type updateCompanyRequest struct {
-	CompanyID   uint     `form:"company_id" validate:"required~company id tidak boleh kosong"`
-	Name        *string  `form:"name"`
-	Description *string  `form:"description"`
-	ImageURL    *string  `form:"image_url"`
-	Proof       []string `form:"proof"`
+	CompanyID   uint    `form:"company_id" validate:"required~company id tidak boleh kosong"`
+	Name        *string `form:"name"`
+	Description *string `form:"description"`
+	// Images is set by the service after an upload, it cannot be sent by clients
+	Images  entity.Images `form:"-"`
+	Proof   []string      `form:"proof"`
+	Aliases []string      `form:"aliases"`
+	Domains []string      `form:"domains"`
+	Country *string       `form:"country"`
+	// BarcodePrefixes are the GS1 company prefixes at the start of the company's product barcodes
+	BarcodePrefixes []string `form:"barcode_prefixes"`
+	// ImageSourceURL is fetched by the server when no image file is uploaded
+	ImageSourceURL string `form:"image_source_url"`
 }
 
 type updateCompanyArgs struct {
@@ -68,12 +85,12 @@ func (ctrl *controller) Create(c *fiber.Ctx) error {
 	}
 
 	formHeader, err := c.FormFile("image")
-	if err != nil {
+	if err != nil && request.ImageSourceURL == "" {
 		response := helper.ResponseFailed("Image file is required")
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	if err := ctrl.service.Create(c.Context(), &createCompanyArgs{
+	if err := ctrl.service.Create(c.UserContext(), &createCompanyArgs{
 		FormHeader: formHeader,
 		Request:    &request,
 	}); err != nil {
@@ -85,7 +102,11 @@ func (ctrl *controller) Create(c *fiber.Ctx) error {
 }
 
 func (ctrl *controller) Find(c *fiber.Ctx) error {
-	count, err := ctrl.service.Count(c.Context())
+	if pagination.IsCursorRequest(c) {
+		return ctrl.findByCursor(c)
+	}
+
+	count, err := ctrl.service.Count(c.UserContext())
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
@@ -96,7 +117,7 @@ func (ctrl *controller) Find(c *fiber.Ctx) error {
 		Limit:  pages.Size(),
 	}
 
-	result, err := ctrl.service.Find(c.Context(), &paginationParams)
+	result, err := ctrl.service.Find(c.UserContext(), &paginationParams)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
@@ -105,10 +126,25 @@ func (ctrl *controller) Find(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(data)
 }
 
+func (ctrl *controller) findByCursor(c *fiber.Ctx) error {
+	cursorParams, err := pagination.NewCursorFromRequest(c)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	result, pages, err := ctrl.service.FindByCursor(c.UserContext(), cursorParams)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	data := helper.ResponseSuccessWithCursor("Berhasil memuat daftar merek yang diboikot", result, pages)
+	return c.Status(fiber.StatusOK).JSON(data)
+}
+
 func (ctrl *controller) FindOneByID(c *fiber.Ctx) error {
 	companyID := helper.ParseStringToUint(c.Params("id"))
 
-	company, err := ctrl.service.FindOneByID(c.Context(), companyID)
+	company, err := ctrl.service.FindOneByID(c.UserContext(), companyID)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
@@ -129,13 +165,13 @@ func (ctrl *controller) Update(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	company, err := ctrl.service.FindOneByID(c.Context(), request.CompanyID)
+	company, err := ctrl.service.FindOneByID(c.UserContext(), request.CompanyID)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
 	formHeader, _ := c.FormFile("image")
-	if err := ctrl.service.Update(c.Context(), &updateCompanyArgs{
+	if err := ctrl.service.Update(c.UserContext(), &updateCompanyArgs{
 		Company:    company,
 		FormHeader: formHeader,
 		Request:    &request,
@@ -149,15 +185,47 @@ func (ctrl *controller) Update(c *fiber.Ctx) error {
 
 func (ctrl *controller) Delete(c *fiber.Ctx) error {
 	companyID := helper.ParseStringToUint(c.Params("id"))
-	company, err := ctrl.service.FindOneByID(c.Context(), companyID)
+	company, err := ctrl.service.FindOneByID(c.UserContext(), companyID)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
-	if err := ctrl.service.Delete(c.Context(), company); err != nil {
+	if err := ctrl.service.Delete(c.UserContext(), company); err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
 	res := helper.ResponseSuccess("Berhasil menghapus merek dari daftar boikot", nil)
 	return c.Status(fiber.StatusOK).JSON(res)
 }
+
+func (ctrl *controller) PresignImageUpload(c *fiber.Ctx) error {
+	companyID := helper.ParseStringToUint(c.Params("id"))
+	company, err := ctrl.service.FindOneByID(c.UserContext(), companyID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	upload, err := ctrl.service.PresignImageUpload(c.UserContext(), company)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Silakan unggah gambar ke alamat berikut", upload)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) FinalizeImageUpload(c *fiber.Ctx) error {
+	companyID := helper.ParseStringToUint(c.Params("id"))
+	company, err := ctrl.service.FindOneByID(c.UserContext(), companyID)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	images, err := ctrl.service.FinalizeImageUpload(c.UserContext(), company)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil menyimpan gambar", images)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
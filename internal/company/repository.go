@@ -3,7 +3,6 @@ package company
 import (
 	"context"
 	"errors"
-	"fmt"
 
 	"github.com/ariefro/buycut-api/internal/entity"
 	"github.com/ariefro/buycut-api/pkg/common"
@@ -13,15 +12,18 @@ import (
 
 type Repository interface {
 	Create(ctx context.Context, companies *entity.Company) error
-	CountCompanies(ctx context.Context, keyword string) (int64, error)
 	Count(ctx context.Context) (int64, error)
 	Find(ctx context.Context, paginationParams *pagination.PaginationParams) ([]*entity.Company, error)
+	FindByCursor(ctx context.Context, cursorParams *pagination.CursorParams) ([]*entity.Company, error)
 	FindOneByID(ctx context.Context, companyID uint) (*entity.Company, error)
 	Update(ctx context.Context, companyID uint, data map[string]interface{}) error
 	DeleteAssociateCompanyBrandsInTx(ctx context.Context, tx *gorm.DB, companyID uint) error
 	DeleteInTx(ctx context.Context, tx *gorm.DB, companyID uint) error
 }
 
+// SortByName is the keyset order of the company list
+var SortByName = pagination.Sort{Column: common.ColumnName}
+
 type repository struct {
 	db *gorm.DB
 }
@@ -38,31 +40,33 @@ func (r *repository) Create(ctx context.Context, company *entity.Company) error
 	return nil
 }
 
-func (r *repository) CountCompanies(ctx context.Context, keyword string) (int64, error) {
+func (r *repository) Count(ctx context.Context) (int64, error) {
 	var count int64
-	key := "%" + keyword + "%"
-	if err := r.db.WithContext(ctx).Model(&entity.Company{}).Where("LOWER(name) LIKE LOWER(?)", key).Count(&count).Error; err != nil {
+	query := r.db.WithContext(ctx).Model(&entity.Company{})
+
+	if err := query.Count(&count).Error; err != nil {
 		return 0, err
 	}
+
 	return count, nil
 }
 
-func (r *repository) Count(ctx context.Context) (int64, error) {
-	var count int64
+func (r *repository) Find(ctx context.Context, paginationParams *pagination.PaginationParams) ([]*entity.Company, error) {
+	var companies []*entity.Company
 	query := r.db.WithContext(ctx).Model(&entity.Company{})
 
-	if err := query.Count(&count).Error; err != nil {
-		return 0, fmt.Errorf("failed to count companies: %w", err)
+	if err := query.Limit(paginationParams.Limit).Offset(paginationParams.Offset).Order(SortByName.Order(false)).Find(&companies).Error; err != nil {
+		return nil, err
 	}
 
-	return count, nil
+	return companies, nil
 }
 
-func (r *repository) Find(ctx context.Context, paginationParams *pagination.PaginationParams) ([]*entity.Company, error) {
+func (r *repository) FindByCursor(ctx context.Context, cursorParams *pagination.CursorParams) ([]*entity.Company, error) {
 	var companies []*entity.Company
 	query := r.db.WithContext(ctx).Model(&entity.Company{})
 
-	if err := query.Limit(paginationParams.Limit).Offset(paginationParams.Offset).Order("name asc").Find(&companies).Error; err != nil {
+	if err := query.Scopes(cursorParams.Scope(SortByName)).Find(&companies).Error; err != nil {
 		return nil, err
 	}
 
@@ -76,6 +80,7 @@ func (r *repository) FindOneByID(ctx context.Context, companyID uint) (*entity.C
 			return db.Order("name ASC")
 		}).
 		Preload("Brands.Company").
+		Preload("Brands.Owners.Company").
 		First(&company, "id = ?", companyID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New(common.CompanyNotFound)
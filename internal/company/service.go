@@ -2,15 +2,19 @@ package company
 
 import (
 	"context"
+	"errors"
 	"mime/multipart"
+	"strings"
 
 	"github.com/ariefro/buycut-api/config"
 	cloudstorage "github.com/ariefro/buycut-api/internal/cloudstorage"
 	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/internal/search"
 	"github.com/ariefro/buycut-api/pkg/common"
 	"github.com/ariefro/buycut-api/pkg/helper"
 	"github.com/ariefro/buycut-api/pkg/pagination"
 	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -18,19 +22,24 @@ type Service interface {
 	Create(ctx context.Context, args *createCompanyArgs) error
 	Count(ctx context.Context) (int64, error)
 	Find(ctx context.Context, paginationParams *pagination.PaginationParams) ([]*entity.Company, error)
+	FindByCursor(ctx context.Context, cursorParams *pagination.CursorParams) ([]*entity.Company, *pagination.CursorPages, error)
 	FindOneByID(ctx context.Context, companyID uint) (*entity.Company, error)
 	Update(ctx context.Context, args *updateCompanyArgs) error
 	Delete(ctx context.Context, company *entity.Company) error
+	PresignImageUpload(ctx context.Context, company *entity.Company) (*cloudstorage.PresignedUpload, error)
+	FinalizeImageUpload(ctx context.Context, company *entity.Company) (entity.Images, error)
 }
 
 type service struct {
-	db     *gorm.DB
-	config *config.Config
-	repo   Repository
+	db         *gorm.DB
+	config     *config.Config
+	repo       Repository
+	searchRepo search.Repository
+	storage    cloudstorage.Storage
 }
 
-func NewService(db *gorm.DB, config *config.Config, repo Repository) Service {
-	return &service{db, config, repo}
+func NewService(db *gorm.DB, config *config.Config, repo Repository, searchRepo search.Repository, storage cloudstorage.Storage) Service {
+	return &service{db, config, repo, searchRepo, storage}
 }
 
 type uploadImageArgs struct {
@@ -39,23 +48,43 @@ type uploadImageArgs struct {
 }
 
 func (s *service) Create(ctx context.Context, args *createCompanyArgs) error {
+	barcodePrefixes, err := normalizeBarcodePrefixes(args.Request.BarcodePrefixes)
+	if err != nil {
+		return err
+	}
+
+	country, err := normalizeCountry(args.Request.Country)
+	if err != nil {
+		return err
+	}
+
 	slug := helper.GenerateSlug(args.Request.Name)
 	company := &entity.Company{
-		Name:        args.Request.Name,
-		Slug:        slug,
-		Description: args.Request.Description,
-		Proof:       args.Request.Proof,
+		Name:            args.Request.Name,
+		Slug:            slug,
+		Description:     args.Request.Description,
+		Proof:           args.Request.Proof,
+		Aliases:         args.Request.Aliases,
+		Domains:         helper.NormalizeDomains(args.Request.Domains),
+		BarcodePrefixes: barcodePrefixes,
+		Country:         country,
 	}
 
 	if err := s.repo.Create(ctx, company); err != nil {
 		return err
 	}
 
-	imageURL, err := cloudstorage.UploadImage(ctx, &cloudstorage.UploadImageArgs{
+	if err := s.searchRepo.ReplaceCompanyTerms(ctx, company.ID, company.Name, company.Aliases); err != nil {
+		return err
+	}
+
+	images, err := cloudstorage.UploadImage(ctx, s.storage, &cloudstorage.UploadImageArgs{
 		CompanyID: company.ID,
 		File:      args.FormHeader,
+		SourceURL: args.Request.ImageSourceURL,
 		Slug:      slug,
-	}, s.configureCloudinary())
+		Limits:    s.config.CompanyImageLimits(),
+	})
 	if err != nil {
 		return err
 	}
@@ -63,7 +92,7 @@ func (s *service) Create(ctx context.Context, args *createCompanyArgs) error {
 	if err := s.Update(ctx, &updateCompanyArgs{
 		Request: &updateCompanyRequest{
 			CompanyID: company.ID,
-			ImageURL:  &imageURL,
+			Images:    images,
 		},
 	}); err != nil {
 		return err
@@ -80,6 +109,19 @@ func (s *service) Find(ctx context.Context, paginationParams *pagination.Paginat
 	return s.repo.Find(ctx, paginationParams)
 }
 
+func (s *service) FindByCursor(ctx context.Context, cursorParams *pagination.CursorParams) ([]*entity.Company, *pagination.CursorPages, error) {
+	companies, err := s.repo.FindByCursor(ctx, cursorParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	companies, pages := pagination.NewCursorPages(cursorParams, SortByName, companies, func(company *entity.Company) (string, uint) {
+		return company.Name, company.ID
+	})
+
+	return companies, pages, nil
+}
+
 func (s *service) FindOneByID(ctx context.Context, companyID uint) (*entity.Company, error) {
 	return s.repo.FindOneByID(ctx, companyID)
 }
@@ -101,40 +143,92 @@ func (s *service) Update(ctx context.Context, args *updateCompanyArgs) error {
 		dataToUpdate[common.ColumnProof] = pq.StringArray(args.Request.Proof)
 	}
 
-	if args.FormHeader != nil {
+	if args.Request.Aliases != nil {
+		dataToUpdate[common.ColumnAliases] = pq.StringArray(args.Request.Aliases)
+	}
+
+	if args.Request.Domains != nil {
+		dataToUpdate[common.ColumnDomains] = pq.StringArray(helper.NormalizeDomains(args.Request.Domains))
+	}
+
+	if args.Request.Country != nil {
+		country, err := normalizeCountry(*args.Request.Country)
+		if err != nil {
+			return err
+		}
+
+		dataToUpdate[common.ColumnCountry] = country
+	}
+
+	if args.Request.BarcodePrefixes != nil {
+		barcodePrefixes, err := normalizeBarcodePrefixes(args.Request.BarcodePrefixes)
+		if err != nil {
+			return err
+		}
+
+		dataToUpdate[common.ColumnBarcodePrefixes] = pq.StringArray(barcodePrefixes)
+	}
+
+	var uploadedImages map[string]string
+	if args.FormHeader != nil || args.Request.ImageSourceURL != "" {
 		// jika tidak ada inputan nama, set slug dari current company
 		if args.Request.Name == nil {
 			slug = args.Company.Slug
 		}
 
-		// jika ada inputan nama dan tidak sama dengan nama dari current company, hapus file lama di cloud
-		if args.Request.Name != nil && *args.Request.Name != args.Company.Name {
-			if err := cloudstorage.DeleteFile(&cloudstorage.DeleteArgs{
-				CompanyID: args.Company.ID,
-				Config:    s.configureCloudinary(),
-				Slug:      args.Company.Slug,
-			}); err != nil {
-				return err
-			}
-		}
-
-		imageURL, err := cloudstorage.UploadImage(ctx, &cloudstorage.UploadImageArgs{
+		images, err := cloudstorage.UploadImage(ctx, s.storage, &cloudstorage.UploadImageArgs{
 			CompanyID: args.Request.CompanyID,
 			File:      args.FormHeader,
+			SourceURL: args.Request.ImageSourceURL,
 			Slug:      slug,
-		}, s.configureCloudinary())
+			Limits:    s.config.CompanyImageLimits(),
+		})
 		if err != nil {
 			return err
 		}
 
-		dataToUpdate[common.ColumnImageURL] = imageURL
+		uploadedImages = images
+		dataToUpdate[common.ColumnImages] = entity.Images(images)
+		dataToUpdate[common.ColumnImageMissing] = false
+	}
+
+	if args.Request.Images != nil {
+		dataToUpdate[common.ColumnImages] = args.Request.Images
+		dataToUpdate[common.ColumnImageMissing] = false
+	}
+
+	if err := s.repo.Update(ctx, args.Request.CompanyID, dataToUpdate); err != nil {
+		if uploadedImages != nil {
+			if errDelete := cloudstorage.DeleteImages(context.WithoutCancel(ctx), s.storage, uploadedImages); errDelete != nil {
+				log.Errorln("failed to remove uploaded company image:", errDelete)
+			}
+		}
+
+		return err
 	}
 
-	if args.Request.ImageURL != nil {
-		dataToUpdate[common.ColumnImageURL] = *args.Request.ImageURL
+	// the row already points at the new image, a leftover old one is removed by the reconciliation
+	if uploadedImages != nil && args.Company != nil {
+		if err := cloudstorage.DeleteImages(ctx, s.storage, args.Company.Images); err != nil {
+			log.Errorln("failed to remove old company image:", err)
+		}
 	}
 
-	return s.repo.Update(ctx, args.Request.CompanyID, dataToUpdate)
+	// keep the prefix lookup terms in sync with the new name or aliases
+	if args.Company != nil && (args.Request.Name != nil || args.Request.Aliases != nil) {
+		name, aliases := args.Company.Name, []string(args.Company.Aliases)
+		if args.Request.Name != nil {
+			name = *args.Request.Name
+		}
+
+		if args.Request.Aliases != nil {
+			aliases = args.Request.Aliases
+		}
+
+		return s.searchRepo.ReplaceCompanyTerms(ctx, args.Request.CompanyID, name, aliases)
+	}
+
+	return nil
 }
 
 func (s *service) Delete(ctx context.Context, company *entity.Company) error {
@@ -152,30 +246,84 @@ func (s *service) Delete(ctx context.Context, company *entity.Company) error {
 		return errTx
 	}
 
-	if err := cloudstorage.DeleteAssetsByTag(&cloudstorage.DeleteAssetsByTagArgs{
-		CompanyID: company.ID,
-		Config:    s.configureCloudinary(),
-	}); err != nil {
+	if err := s.storage.DeleteCompanyAssets(ctx, company.ID); err != nil {
 		return err
 	}
 
-	if err := cloudstorage.DeleteEmptyFolder(&cloudstorage.DeleteEmptyFolderArgs{
-		CompanyID: company.ID,
-		Config:    s.configureCloudinary(),
-	}); err != nil {
+	if err := s.storage.DeleteEmptyFolder(ctx, company.ID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *service) configureCloudinary() *config.CloudinaryConfig {
-	var config = &config.CloudinaryConfig{
-		CloudinaryCloudName:    s.config.CloudinaryCloudName,
-		CloudinaryApiKey:       s.config.CloudinaryApiKey,
-		CloudinarySecretKey:    s.config.CloudinarySecretKey,
-		CloudinaryBuycutFolder: s.config.CloudinaryBuycutFolder,
+func (s *service) PresignImageUpload(ctx context.Context, company *entity.Company) (*cloudstorage.PresignedUpload, error) {
+	return cloudstorage.PresignImageUpload(ctx, s.storage, s.directUploadArgs(company))
+}
+
+// FinalizeImageUpload turns the image the client uploaded straight to the storage into the company's image
+func (s *service) FinalizeImageUpload(ctx context.Context, company *entity.Company) (entity.Images, error) {
+	images, err := cloudstorage.FinalizeImageUpload(ctx, s.storage, s.directUploadArgs(company))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, company.ID, map[string]interface{}{
+		common.ColumnImages:       entity.Images(images),
+		common.ColumnImageMissing: false,
+	}); err != nil {
+		if errDelete := cloudstorage.DeleteImages(context.WithoutCancel(ctx), s.storage, images); errDelete != nil {
+			log.Errorln("failed to remove uploaded company image:", errDelete)
+		}
+
+		return nil, err
+	}
+
+	// the row already points at the new image, a leftover old one is removed by the reconciliation
+	if err := cloudstorage.DeleteImages(ctx, s.storage, company.Images); err != nil {
+		log.Errorln("failed to remove old company image:", err)
+	}
+
+	return images, nil
+}
+
+func (s *service) directUploadArgs(company *entity.Company) *cloudstorage.DirectUploadArgs {
+	return &cloudstorage.DirectUploadArgs{
+		CompanyID: company.ID,
+		Slug:      company.Slug,
+		Limits:    s.config.CompanyImageLimits(),
+	}
+}
+
+// normalizeBarcodePrefixes strips separators from the prefixes and rejects anything that is not a GS1 company prefix
+func normalizeBarcodePrefixes(inputs []string) ([]string, error) {
+	prefixes := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		prefix := strings.NewReplacer(" ", "", "-", "").Replace(input)
+		if prefix == "" {
+			continue
+		}
+
+		if !helper.IsDigits(prefix) || len(prefix) < 6 || len(prefix) > 12 {
+			return nil, errors.New(common.InvalidBarcodePrefix)
+		}
+
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
+
+// normalizeCountry upper cases an ISO 3166-1 alpha-2 code, an empty code leaves the country unknown
+func normalizeCountry(input string) (string, error) {
+	country := strings.ToUpper(strings.TrimSpace(input))
+	if country == "" {
+		return "", nil
+	}
+
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return "", errors.New(common.InvalidCountryCode)
 	}
 
-	return config
+	return country, nil
 }
@@ -7,13 +7,19 @@ import (
 )
 
 type Company struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"not null;unique" json:"name"`
-	Slug        string         `gorm:"not null;unique" json:"slug"`
-	Description string         `gorm:"not null" json:"description"`
-	ImageURL    string         `gorm:"not null;type:varchar(255)" json:"image_url"`
-	Proof       pq.StringArray `gorm:"not null;type:text[]" json:"proof"`
-	Brands      []Brand        `gorm:"foreignKey:CompanyID" json:"brands,omitempty"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"-"`
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"not null;unique" json:"name"`
+	Slug        string `gorm:"not null;unique" json:"slug"`
+	Description string `gorm:"not null" json:"description"`
+	Images      Images `gorm:"type:jsonb;not null;default:'{}'" json:"images"`
+	// ImageMissing is set by the asset reconciliation when an image of the company is not in the storage
+	ImageMissing    bool           `gorm:"not null;default:false" json:"image_missing"`
+	Proof           pq.StringArray `gorm:"not null;type:text[]" json:"proof"`
+	Aliases         pq.StringArray `gorm:"type:text[]" json:"aliases"`
+	Domains         pq.StringArray `gorm:"type:text[]" json:"domains"`
+	Country         string         `gorm:"type:varchar(2);index" json:"country"` // ISO 3166-1 alpha-2 code
+	BarcodePrefixes pq.StringArray `gorm:"type:text[]" json:"barcode_prefixes"`
+	Brands          []Brand        `gorm:"foreignKey:CompanyID" json:"brands,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"-"`
 }
@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// ImageOriginal names the single image stored before uploads were split into sized variants
+const ImageOriginal = "original"
+
+// ImageSVG names the sanitized SVG of a logo uploaded as one, its sized variants are rasterized from it
+const ImageSVG = "svg"
+
+// Images maps the name of an image variant, its size in pixels or svg, to its URL. It is stored as jsonb.
+type Images map[string]string
+
+func (images Images) Value() (driver.Value, error) {
+	if images == nil {
+		return "{}", nil
+	}
+
+	value, err := json.Marshal(images)
+	return string(value), err
+}
+
+func (images *Images) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*images = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, images)
+	case string:
+		return json.Unmarshal([]byte(v), images)
+	default:
+		return errors.New("failed to scan images")
+	}
+}
@@ -0,0 +1,54 @@
+package entity
+
+import "time"
+
+const (
+	OwnershipRoleOwner        = "owner"
+	OwnershipRoleLicensor     = "licensor"
+	OwnershipRoleJointVenture = "joint_venture"
+)
+
+// BoycottOwnershipRoles lists the ownership roles that make a brand count as boycotted
+var BoycottOwnershipRoles = []string{
+	OwnershipRoleOwner,
+	OwnershipRoleLicensor,
+	OwnershipRoleJointVenture,
+}
+
+// BrandOwnership is a period in which a company is related to a brand.
+// A nil StartedAt means the start is unknown, a nil EndedAt means the relation is still ongoing.
+type BrandOwnership struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	BrandID   uint       `gorm:"not null;index" json:"-"`
+	CompanyID uint       `gorm:"not null;index" json:"-"`
+	Company   *Company   `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company"`
+	Role      string     `gorm:"not null;type:varchar(32)" json:"role"`
+	Stake     *float64   `gorm:"type:numeric(5,2)" json:"stake"`
+	StartedAt *time.Time `gorm:"type:date" json:"started_at"`
+	EndedAt   *time.Time `gorm:"type:date" json:"ended_at"`
+	SourceURL string     `gorm:"type:varchar(255)" json:"source_url"`
+	CreatedAt time.Time  `json:"-"`
+	UpdatedAt time.Time  `json:"-"`
+}
+
+func IsValidOwnershipRole(role string) bool {
+	switch role {
+	case OwnershipRoleOwner, OwnershipRoleLicensor, OwnershipRoleJointVenture:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsActiveAt reports whether the ownership period covers the given date
+func (o *BrandOwnership) IsActiveAt(at time.Time) bool {
+	if o.StartedAt != nil && o.StartedAt.After(at) {
+		return false
+	}
+
+	if o.EndedAt != nil && !o.EndedAt.After(at) {
+		return false
+	}
+
+	return true
+}
@@ -1,14 +1,26 @@
 package entity
 
-import "time"
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
 
 type Brand struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"not null;unique" json:"name"`
-	Slug      string    `gorm:"not null;unique" json:"slug"`
-	ImageURL  string    `gorm:"type:varchar(255)" json:"image_url"`
-	CompanyID uint      `gorm:"not null" json:"-"`
-	Company   *Company  `gorm:"foreignKey:CompanyID" json:"company"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"-"`
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	Name   string `gorm:"not null;unique" json:"name"`
+	Slug   string `gorm:"not null;unique" json:"slug"`
+	Images Images `gorm:"type:jsonb;not null;default:'{}'" json:"images"`
+	// ImageMissing is set by the asset reconciliation when an image of the brand is not in the storage
+	ImageMissing bool             `gorm:"not null;default:false" json:"image_missing"`
+	Description  string           `gorm:"type:text" json:"description"`
+	Proof        pq.StringArray   `gorm:"type:text[]" json:"proof"`
+	Aliases      pq.StringArray   `gorm:"type:text[]" json:"aliases"`
+	Domains      pq.StringArray   `gorm:"type:text[]" json:"domains"`
+	Category     string           `gorm:"type:varchar(64);index" json:"category"`
+	CompanyID    uint             `gorm:"not null" json:"-"`
+	Company      *Company         `gorm:"foreignKey:CompanyID" json:"company"`
+	Owners       []BrandOwnership `gorm:"foreignKey:BrandID;constraint:OnDelete:CASCADE" json:"owners,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"-"`
 }
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// SearchQueryStat aggregates the searches for a normalized query on a day. Nothing about who searched is kept.
+type SearchQueryStat struct {
+	ID              uint      `gorm:"primaryKey"`
+	Query           string    `gorm:"not null;type:varchar(100);uniqueIndex:idx_search_query_stats_query_day"`
+	Day             time.Time `gorm:"not null;type:date;uniqueIndex:idx_search_query_stats_query_day;index"`
+	Searches        int64     `gorm:"not null;default:0"`
+	ZeroResults     int64     `gorm:"not null;default:0"`
+	LastResultCount int64     `gorm:"not null;default:0"`
+	LastSearchedAt  time.Time `gorm:"not null"`
+}
@@ -0,0 +1,14 @@
+package entity
+
+// SearchTerm is a name or an alias of a company or a brand, used for prefix lookups.
+// Exactly one of CompanyID and BrandID is set.
+type SearchTerm struct {
+	ID        uint     `gorm:"primaryKey"`
+	CompanyID *uint    `gorm:"index"`
+	Company   *Company `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE"`
+	BrandID   *uint    `gorm:"index"`
+	Brand     *Brand   `gorm:"foreignKey:BrandID;constraint:OnDelete:CASCADE"`
+	Term      string   `gorm:"not null"`
+	Key       string   `gorm:"not null"`
+	Alias     bool     `gorm:"not null;default:false"`
+}
@@ -6,8 +6,11 @@ package initializer
 import (
 	"github.com/ariefro/buycut-api/config"
 	"github.com/ariefro/buycut-api/database"
+	"github.com/ariefro/buycut-api/internal/asset"
 	"github.com/ariefro/buycut-api/internal/brand"
+	"github.com/ariefro/buycut-api/internal/cloudstorage"
 	"github.com/ariefro/buycut-api/internal/company"
+	"github.com/ariefro/buycut-api/internal/search"
 	"github.com/ariefro/buycut-api/internal/server"
 	"github.com/ariefro/buycut-api/internal/user"
 	"github.com/google/wire"
@@ -31,15 +34,40 @@ var brandSet = wire.NewSet(
 	brand.NewController,
 )
 
+var searchSet = wire.NewSet(
+	search.NewRepository,
+	search.NewService,
+	search.NewController,
+)
+
+var assetSet = wire.NewSet(
+	asset.NewRepository,
+	asset.NewService,
+)
+
 func InitializedServer() error {
 	wire.Build(
 		config.NewLoadConfig,
 		database.NewConnectPostgres,
+		cloudstorage.NewStorage,
 		userSet,
 		companySet,
 		brandSet,
+		searchSet,
+		assetSet,
 		server.NewFiberServer,
 	)
 
 	return nil
 }
+
+func InitializedAssetService() asset.Service {
+	wire.Build(
+		config.NewLoadConfig,
+		database.NewConnectPostgres,
+		cloudstorage.NewStorage,
+		assetSet,
+	)
+
+	return nil
+}
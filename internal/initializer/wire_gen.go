@@ -9,8 +9,11 @@ package initializer
 import (
 	"github.com/ariefro/buycut-api/config"
 	"github.com/ariefro/buycut-api/database"
+	"github.com/ariefro/buycut-api/internal/asset"
 	"github.com/ariefro/buycut-api/internal/brand"
+	"github.com/ariefro/buycut-api/internal/cloudstorage"
 	"github.com/ariefro/buycut-api/internal/company"
+	"github.com/ariefro/buycut-api/internal/search"
 	"github.com/ariefro/buycut-api/internal/server"
 	"github.com/ariefro/buycut-api/internal/user"
 	"github.com/google/wire"
@@ -25,15 +28,30 @@ func InitializedServer() error {
 	service := user.NewService(configConfig, repository)
 	controller := user.NewController(service)
 	companyRepository := company.NewRepository(db)
-	companyService := company.NewService(db, configConfig, companyRepository)
+	searchRepository := search.NewRepository(db)
+	storage := cloudstorage.NewStorage(configConfig)
+	companyService := company.NewService(db, configConfig, companyRepository, searchRepository, storage)
 	companyController := company.NewController(companyService)
 	brandRepository := brand.NewRepository(db)
-	brandService := brand.NewService(configConfig, brandRepository, companyRepository)
+	searchService := search.NewService(searchRepository)
+	brandService := brand.NewService(db, configConfig, brandRepository, companyRepository, searchRepository, searchService, storage)
 	brandController := brand.NewController(brandService, companyService)
-	error2 := server.NewFiberServer(configConfig, controller, companyController, brandController)
+	searchController := search.NewController(searchService)
+	assetRepository := asset.NewRepository(db)
+	assetService := asset.NewService(assetRepository, storage)
+	error2 := server.NewFiberServer(configConfig, controller, companyController, brandController, searchController, searchService, assetService)
 	return error2
 }
 
+func InitializedAssetService() asset.Service {
+	configConfig := config.NewLoadConfig()
+	db := database.NewConnectPostgres(configConfig)
+	repository := asset.NewRepository(db)
+	storage := cloudstorage.NewStorage(configConfig)
+	service := asset.NewService(repository, storage)
+	return service
+}
+
 // initializer.go:
 
 var userSet = wire.NewSet(user.NewRepository, user.NewService, user.NewController)
@@ -41,3 +59,7 @@ var userSet = wire.NewSet(user.NewRepository, user.NewService, user.NewControlle
 var companySet = wire.NewSet(company.NewRepository, company.NewService, company.NewController)
 
 var brandSet = wire.NewSet(brand.NewRepository, brand.NewService, brand.NewController)
+
+var searchSet = wire.NewSet(search.NewRepository, search.NewService, search.NewController)
+
+var assetSet = wire.NewSet(asset.NewRepository, asset.NewService)
@@ -0,0 +1,185 @@
+package search
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ariefro/buycut-api/pkg/helper"
+	"github.com/ariefro/buycut-api/pkg/pagination"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller interface {
+	Suggest(c *fiber.Ctx) error
+	Cacheable(c *fiber.Ctx) error
+	TopQueries(c *fiber.Ctx) error
+	ZeroResultQueries(c *fiber.Ctx) error
+	Trends(c *fiber.Ctx) error
+}
+
+type controller struct {
+	service Service
+}
+
+func NewController(service Service) Controller {
+	return &controller{service}
+}
+
+type suggestRequest struct {
+	Query string `query:"q"`
+	Limit int    `query:"limit"`
+}
+
+type suggestion struct {
+	Name    string `json:"name"`
+	Slug    string `json:"slug"`
+	Type    string `json:"type"`    // Either "company" or "brand"
+	Matched string `json:"matched"` // The name or alias that starts with the query
+}
+
+type analyticsRequest struct {
+	From     string `query:"from"`
+	To       string `query:"to"`
+	Limit    int    `query:"limit"`
+	Interval string `query:"interval"`
+	Query    string `query:"query"`
+}
+
+type analyticsArgs struct {
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Interval string
+	Query    string
+}
+
+type queryStat struct {
+	Query           string    `json:"query"`
+	Searches        int64     `json:"searches"`
+	ZeroResults     int64     `json:"zero_results"`
+	LastResultCount int64     `json:"last_result_count"`
+	LastSearchedAt  time.Time `json:"last_searched_at"`
+}
+
+type trendPoint struct {
+	Period      time.Time `json:"period"` // The first day of the day, week or month
+	Searches    int64     `json:"searches"`
+	ZeroResults int64     `json:"zero_results"`
+	Queries     int64     `json:"queries"` // Distinct queries
+}
+
+func (ctrl *controller) Suggest(c *fiber.Ctx) error {
+	var request suggestRequest
+	if err := c.QueryParser(&request); err != nil {
+		response := helper.ResponseFailed(err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	result, err := ctrl.service.Suggest(c.UserContext(), &request)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	// suggestions change rarely, let clients and proxies reuse them briefly
+	c.Set(fiber.HeaderCacheControl, "public, max-age=60")
+
+	res := helper.ResponseSuccess("Berhasil memuat saran pencarian", result)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+// Cacheable answers conditional GET requests with 304 Not Modified while the searchable data
+// is unchanged and marks successful responses as cacheable by clients and proxies
+func (ctrl *controller) Cacheable(c *fiber.Ctx) error {
+	etag, err := ctrl.service.ETag(c.UserContext())
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=60")
+	c.Set(fiber.HeaderETag, etag)
+	if matchesETag(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		// the search still counts, like the handler it counts only the first page
+		if c.QueryInt(pagination.PageVar, 1) <= 1 {
+			ctrl.service.Record(c.Query("keyword"), UnknownResults)
+		}
+
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	// failures such as a keyword that is too short must not be cached
+	if c.Response().StatusCode() != fiber.StatusOK {
+		c.Response().Header.Del(fiber.HeaderCacheControl)
+		c.Response().Header.Del(fiber.HeaderETag)
+	}
+
+	return nil
+}
+
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ctrl *controller) TopQueries(c *fiber.Ctx) error {
+	args, err := ctrl.parseAnalyticsRequest(c)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	result, err := ctrl.service.FindTopQueries(c.UserContext(), args)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil memuat pencarian terpopuler", result)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) ZeroResultQueries(c *fiber.Ctx) error {
+	args, err := ctrl.parseAnalyticsRequest(c)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	result, err := ctrl.service.FindZeroResultQueries(c.UserContext(), args)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil memuat pencarian tanpa hasil", result)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) Trends(c *fiber.Ctx) error {
+	args, err := ctrl.parseAnalyticsRequest(c)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	result, err := ctrl.service.FindTrends(c.UserContext(), args)
+	if err != nil {
+		return helper.GenerateErrorResponse(c, err.Error())
+	}
+
+	res := helper.ResponseSuccess("Berhasil memuat tren pencarian", result)
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (ctrl *controller) parseAnalyticsRequest(c *fiber.Ctx) (*analyticsArgs, error) {
+	var request analyticsRequest
+	if err := c.QueryParser(&request); err != nil {
+		return nil, err
+	}
+
+	return ctrl.service.ParseAnalyticsArgs(&request)
+}
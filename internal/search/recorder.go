@@ -0,0 +1,87 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// recordQueueSize is how many searches can wait to be recorded, more are dropped
+	recordQueueSize = 1000
+	recordTimeout   = 5 * time.Second
+)
+
+// queryRecorder writes recorded searches one at a time from a bounded queue, so a burst of searches
+// neither piles up goroutines nor takes up database connections. The analytics are approximate,
+// searches that do not fit in the queue are dropped.
+type queryRecorder struct {
+	repo    Repository
+	mu      sync.RWMutex
+	closed  bool
+	queries chan *recordedQuery
+	done    chan struct{}
+}
+
+type recordedQuery struct {
+	query   string
+	results int64
+	at      time.Time
+}
+
+func newQueryRecorder(repo Repository) *queryRecorder {
+	recorder := &queryRecorder{
+		repo:    repo,
+		queries: make(chan *recordedQuery, recordQueueSize),
+		done:    make(chan struct{}),
+	}
+
+	go recorder.run()
+	return recorder
+}
+
+func (r *queryRecorder) record(query string, results int64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.queries <- &recordedQuery{query, results, time.Now()}:
+	default:
+		log.Debugln("search query queue is full, dropping:", query)
+	}
+}
+
+func (r *queryRecorder) run() {
+	defer close(r.done)
+
+	for query := range r.queries {
+		ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		if err := r.repo.RecordQuery(ctx, query.query, query.results, query.at); err != nil {
+			log.Errorln("failed to record search query:", err)
+		}
+		cancel()
+	}
+}
+
+// close stops taking searches and waits until the queued ones are written or the context is done
+func (r *queryRecorder) close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queries)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
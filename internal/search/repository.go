@@ -0,0 +1,214 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/pkg/helper"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	ReplaceCompanyTerms(ctx context.Context, companyID uint, name string, aliases []string) error
+	ReplaceBrandTerms(ctx context.Context, brandID uint, name string, aliases []string) error
+	FindByPrefix(ctx context.Context, prefix string, limit int) ([]*suggestion, error)
+	DatasetVersion(ctx context.Context) (string, error)
+	FindTerms(ctx context.Context) ([]*entity.SearchTerm, error)
+	RecordQuery(ctx context.Context, query string, results int64, at time.Time) error
+	FindTopQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error)
+	FindZeroResultQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error)
+	FindTrends(ctx context.Context, args *analyticsArgs) ([]*trendPoint, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) ReplaceCompanyTerms(ctx context.Context, companyID uint, name string, aliases []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&entity.SearchTerm{}, "company_id = ?", companyID).Error; err != nil {
+			return err
+		}
+
+		terms := buildTerms(name, aliases)
+		for _, term := range terms {
+			term.CompanyID = &companyID
+		}
+
+		return createTerms(tx, terms)
+	})
+}
+
+func (r *repository) ReplaceBrandTerms(ctx context.Context, brandID uint, name string, aliases []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&entity.SearchTerm{}, "brand_id = ?", brandID).Error; err != nil {
+			return err
+		}
+
+		terms := buildTerms(name, aliases)
+		for _, term := range terms {
+			term.BrandID = &brandID
+		}
+
+		return createTerms(tx, terms)
+	})
+}
+
+// FindByPrefix returns at most one suggestion per company or brand, preferring names over aliases and shorter terms
+func (r *repository) FindByPrefix(ctx context.Context, prefix string, limit int) ([]*suggestion, error) {
+	var suggestions []*suggestion
+	if err := r.db.WithContext(ctx).Raw(`SELECT name, slug, type, matched FROM (
+			SELECT DISTINCT ON (st.company_id, st.brand_id)
+				COALESCE(c.name, b.name) AS name,
+				COALESCE(c.slug, b.slug) AS slug,
+				CASE WHEN st.company_id IS NOT NULL THEN 'company' ELSE 'brand' END AS type,
+				st.term AS matched,
+				st.alias,
+				LENGTH(st.key) AS key_length
+			FROM search_terms st
+			LEFT JOIN companies c ON c.id = st.company_id
+			LEFT JOIN brands b ON b.id = st.brand_id
+			WHERE st.key LIKE @prefix
+			ORDER BY st.company_id, st.brand_id, st.alias ASC, LENGTH(st.key) ASC
+		) candidates
+		ORDER BY alias ASC, key_length ASC, name ASC
+		LIMIT @limit`,
+		sql.Named("prefix", helper.EscapeLike(TermKey(prefix))+"%"),
+		sql.Named("limit", limit),
+	).Scan(&suggestions).Error; err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// DatasetVersion summarizes the searchable tables, it changes whenever a row is created, updated or deleted.
+// The terms are replaced after their entity is saved, so they are part of the version as well: replacing
+// them always inserts rows with new ids.
+func (r *repository) DatasetVersion(ctx context.Context) (string, error) {
+	var version string
+	if err := r.db.WithContext(ctx).Raw(`SELECT CONCAT_WS(':',
+			(SELECT COUNT(*) || '-' || COALESCE(EXTRACT(EPOCH FROM MAX(updated_at)), 0) FROM companies),
+			(SELECT COUNT(*) || '-' || COALESCE(EXTRACT(EPOCH FROM MAX(updated_at)), 0) FROM brands),
+			(SELECT COUNT(*) || '-' || COALESCE(EXTRACT(EPOCH FROM MAX(updated_at)), 0) FROM brand_ownerships),
+			(SELECT COUNT(*) || '-' || COALESCE(MAX(id), 0) FROM search_terms)
+		)`).Scan(&version).Error; err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+func (r *repository) FindTerms(ctx context.Context) ([]*entity.SearchTerm, error) {
+	var terms []*entity.SearchTerm
+	if err := r.db.WithContext(ctx).Model(&entity.SearchTerm{}).Select("company_id", "brand_id", "term").Find(&terms).Error; err != nil {
+		return nil, err
+	}
+
+	return terms, nil
+}
+
+// RecordQuery adds a search to the daily aggregate of its query, a search with UnknownResults
+// keeps the result count recorded last
+func (r *repository) RecordQuery(ctx context.Context, query string, results int64, at time.Time) error {
+	return r.db.WithContext(ctx).Exec(`INSERT INTO search_query_stats (query, day, searches, zero_results, last_result_count, last_searched_at)
+		VALUES (@query, @day, 1, CASE WHEN @results = 0 THEN 1 ELSE 0 END, GREATEST(@results, 0), @at)
+		ON CONFLICT (query, day) DO UPDATE SET
+			searches = search_query_stats.searches + 1,
+			zero_results = search_query_stats.zero_results + EXCLUDED.zero_results,
+			last_result_count = CASE WHEN @results < 0 THEN search_query_stats.last_result_count ELSE EXCLUDED.last_result_count END,
+			last_searched_at = EXCLUDED.last_searched_at`,
+		sql.Named("query", query),
+		sql.Named("day", at.Format(helper.DateLayout)),
+		sql.Named("results", results),
+		sql.Named("at", at),
+	).Error
+}
+
+func (r *repository) FindTopQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error) {
+	return r.findQueryStats(ctx, args, false, "searches DESC")
+}
+
+// FindZeroResultQueries lists the queries that found nothing, most missed first
+func (r *repository) FindZeroResultQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error) {
+	return r.findQueryStats(ctx, args, true, "zero_results DESC")
+}
+
+func (r *repository) findQueryStats(ctx context.Context, args *analyticsArgs, zeroResultsOnly bool, order string) ([]*queryStat, error) {
+	var stats []*queryStat
+	query := r.db.WithContext(ctx).Model(&entity.SearchQueryStat{}).
+		Select("query, SUM(searches) AS searches, SUM(zero_results) AS zero_results, "+
+			"(ARRAY_AGG(last_result_count ORDER BY last_searched_at DESC))[1] AS last_result_count, MAX(last_searched_at) AS last_searched_at").
+		Where("day BETWEEN ? AND ?", args.From, args.To).
+		Group("query")
+
+	if zeroResultsOnly {
+		query = query.Having("SUM(zero_results) > 0")
+	}
+
+	if err := query.Order(order + ", query ASC").Limit(args.Limit).Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// FindTrends sums the searches per day, week or month, of a single query when one is given
+func (r *repository) FindTrends(ctx context.Context, args *analyticsArgs) ([]*trendPoint, error) {
+	var points []*trendPoint
+	query := r.db.WithContext(ctx).Model(&entity.SearchQueryStat{}).
+		Select("DATE_TRUNC(?, day)::date AS period, SUM(searches) AS searches, SUM(zero_results) AS zero_results, COUNT(DISTINCT query) AS queries", args.Interval).
+		Where("day BETWEEN ? AND ?", args.From, args.To)
+
+	if args.Query != "" {
+		query = query.Where("query = ?", args.Query)
+	}
+
+	if err := query.Group("period").Order("period ASC").Scan(&points).Error; err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+func createTerms(tx *gorm.DB, terms []*entity.SearchTerm) error {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	return tx.Create(terms).Error
+}
+
+// buildTerms returns the name followed by the aliases, skipping blanks and duplicates
+func buildTerms(name string, aliases []string) []*entity.SearchTerm {
+	var terms []*entity.SearchTerm
+	seen := map[string]struct{}{}
+	for i, term := range append([]string{name}, aliases...) {
+		term = strings.TrimSpace(term)
+		key := TermKey(term)
+		if key == "" {
+			continue
+		}
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		terms = append(terms, &entity.SearchTerm{Term: term, Key: key, Alias: i > 0})
+	}
+
+	return terms
+}
+
+// TermKey returns the form names and aliases are stored and looked up by
+func TermKey(term string) string {
+	return helper.NormalizeSearchKey(term)
+}
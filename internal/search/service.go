@@ -0,0 +1,350 @@
+package search
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ariefro/buycut-api/internal/entity"
+	"github.com/ariefro/buycut-api/pkg/ahocorasick"
+	"github.com/ariefro/buycut-api/pkg/common"
+	"github.com/ariefro/buycut-api/pkg/helper"
+)
+
+const (
+	DefaultSuggestionLimit = 8
+	MaxSuggestionLimit     = 20
+
+	DefaultAnalyticsLimit = 20
+	MaxAnalyticsLimit     = 100
+	// DefaultAnalyticsDays is how many days back the analytics reach when no start date is given
+	DefaultAnalyticsDays = 30
+	// maxRecordedQueryLength matches the size of the query column
+	maxRecordedQueryLength = 100
+	// UnknownResults records a search answered without running it, from a cached response
+	UnknownResults = -1
+)
+
+// trendIntervals are the periods search trends can be grouped by
+var trendIntervals = map[string]bool{"day": true, "week": true, "month": true}
+
+type Service interface {
+	Suggest(ctx context.Context, args *suggestRequest) ([]*suggestion, error)
+	ETag(ctx context.Context) (string, error)
+	Scan(ctx context.Context, text string) ([]*Mention, error)
+	Record(query string, results int64)
+	// Close stops recording searches, it returns once the searches already recorded are written
+	Close(ctx context.Context) error
+	ParseAnalyticsArgs(request *analyticsRequest) (*analyticsArgs, error)
+	FindTopQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error)
+	FindZeroResultQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error)
+	FindTrends(ctx context.Context, args *analyticsArgs) ([]*trendPoint, error)
+}
+
+type service struct {
+	repo     Repository
+	matcher  *termMatcher
+	recorder *queryRecorder
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo, &termMatcher{}, newQueryRecorder(repo)}
+}
+
+// Mention is a name or an alias of a company or a brand found in a text.
+// Start and End are character offsets, exactly one of CompanyID and BrandID is set.
+type Mention struct {
+	Text      string
+	Start     int
+	End       int
+	CompanyID *uint
+	BrandID   *uint
+}
+
+// Token is a word of a text normalized like search keys, Start and End are its character offsets in the text
+type Token struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// termMatcher holds the latest index of all names and aliases, it is replaced rather than modified
+type termMatcher struct {
+	mu    sync.RWMutex
+	index *termIndex
+}
+
+// termIndex is the automaton of all names and aliases built from a version of the dataset
+type termIndex struct {
+	version   string
+	automaton *ahocorasick.Matcher
+	// targets holds the terms spelled as each pattern of the automaton
+	targets [][]*entity.SearchTerm
+}
+
+func (s *service) Suggest(ctx context.Context, args *suggestRequest) ([]*suggestion, error) {
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultSuggestionLimit
+	}
+
+	if limit > MaxSuggestionLimit {
+		limit = MaxSuggestionLimit
+	}
+
+	if TermKey(args.Query) == "" {
+		return []*suggestion{}, nil
+	}
+
+	return s.repo.FindByPrefix(ctx, args.Query, limit)
+}
+
+// ETag identifies the current state of the searchable data. The date is part of it because
+// results without an explicit date are resolved against today's ownerships.
+func (s *service) ETag(ctx context.Context) (string, error) {
+	version, err := s.repo.DatasetVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum([]byte(version + "|" + time.Now().Format(helper.DateLayout)))
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// Scan finds the names and aliases mentioned in the text. Overlapping mentions are resolved
+// leftmost first, then longest first, so "Coca Cola Zero" is not also reported as "Coca Cola".
+func (s *service) Scan(ctx context.Context, text string) ([]*Mention, error) {
+	index, err := s.currentIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := Tokenize(text)
+	words := make([]string, len(tokens))
+	for i, token := range tokens {
+		words[i] = token.Text
+	}
+
+	matches := index.automaton.Match(words)
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+
+		return matches[i].End > matches[j].End
+	})
+
+	runes := []rune(text)
+	mentions := []*Mention{}
+	end := 0
+	for _, match := range matches {
+		if match.Start < end {
+			continue
+		}
+
+		end = match.End
+		start, stop := tokens[match.Start].Start, tokens[match.End-1].End
+		for _, term := range index.targets[match.Pattern] {
+			mentions = append(mentions, &Mention{
+				Text:      string(runes[start:stop]),
+				Start:     start,
+				End:       stop,
+				CompanyID: term.CompanyID,
+				BrandID:   term.BrandID,
+			})
+		}
+	}
+
+	return mentions, nil
+}
+
+// currentIndex returns the term index, rebuilding it first when companies or brands changed since it was built
+func (s *service) currentIndex(ctx context.Context) (*termIndex, error) {
+	version, err := s.repo.DatasetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.matcher.mu.RLock()
+	index := s.matcher.index
+	s.matcher.mu.RUnlock()
+	if index != nil && index.version == version {
+		return index, nil
+	}
+
+	s.matcher.mu.Lock()
+	defer s.matcher.mu.Unlock()
+
+	// another request may have rebuilt it while waiting for the lock
+	if s.matcher.index != nil && s.matcher.index.version == version {
+		return s.matcher.index, nil
+	}
+
+	terms, err := s.repo.FindTerms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns [][]string
+	var targets [][]*entity.SearchTerm
+	indexes := map[string]int{}
+	for _, term := range terms {
+		var words []string
+		for _, token := range Tokenize(term.Term) {
+			words = append(words, token.Text)
+		}
+
+		// single characters would match almost any text
+		key := strings.Join(words, " ")
+		if len([]rune(key)) < 2 {
+			continue
+		}
+
+		index, ok := indexes[key]
+		if !ok {
+			index = len(patterns)
+			indexes[key] = index
+			patterns = append(patterns, words)
+			targets = append(targets, nil)
+		}
+
+		targets[index] = append(targets[index], term)
+	}
+
+	s.matcher.index = &termIndex{version, ahocorasick.New(patterns), targets}
+	return s.matcher.index, nil
+}
+
+// Record counts a search of the query in the background, so recording never slows down or fails a search.
+// Only the normalized query is kept, and it is dropped when too many searches wait to be recorded.
+func (s *service) Record(query string, results int64) {
+	key := TermKey(query)
+	if key == "" {
+		return
+	}
+
+	if runes := []rune(key); len(runes) > maxRecordedQueryLength {
+		key = strings.TrimSpace(string(runes[:maxRecordedQueryLength]))
+	}
+
+	s.recorder.record(key, results)
+}
+
+func (s *service) Close(ctx context.Context) error {
+	return s.recorder.close(ctx)
+}
+
+func (s *service) ParseAnalyticsArgs(request *analyticsRequest) (*analyticsArgs, error) {
+	now := time.Now()
+	args := &analyticsArgs{
+		To:       time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+		Limit:    request.Limit,
+		Interval: strings.ToLower(request.Interval),
+		Query:    TermKey(request.Query),
+	}
+
+	if request.To != "" {
+		to, err := helper.ParseDate(request.To)
+		if err != nil {
+			return nil, errors.New(common.InvalidDate)
+		}
+
+		args.To = to
+	}
+
+	args.From = args.To.AddDate(0, 0, -DefaultAnalyticsDays)
+	if request.From != "" {
+		from, err := helper.ParseDate(request.From)
+		if err != nil {
+			return nil, errors.New(common.InvalidDate)
+		}
+
+		args.From = from
+	}
+
+	if args.Limit <= 0 {
+		args.Limit = DefaultAnalyticsLimit
+	}
+
+	if args.Limit > MaxAnalyticsLimit {
+		args.Limit = MaxAnalyticsLimit
+	}
+
+	if args.Interval == "" {
+		args.Interval = "day"
+	}
+
+	if !trendIntervals[args.Interval] {
+		return nil, errors.New(common.InvalidTrendInterval)
+	}
+
+	return args, nil
+}
+
+func (s *service) FindTopQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error) {
+	return s.repo.FindTopQueries(ctx, args)
+}
+
+func (s *service) FindZeroResultQueries(ctx context.Context, args *analyticsArgs) ([]*queryStat, error) {
+	return s.repo.FindZeroResultQueries(ctx, args)
+}
+
+func (s *service) FindTrends(ctx context.Context, args *analyticsArgs) ([]*trendPoint, error) {
+	return s.repo.FindTrends(ctx, args)
+}
+
+// Tokenize splits the text into words made of letters and digits. Apostrophes do not split words,
+// so "L'Oréal" is the single word "loreal" just like its search key.
+func Tokenize(text string) []*Token {
+	var tokens []*Token
+	var current *Token
+	var word []rune
+	for i, r := range []rune(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if current == nil {
+				current = &Token{Start: i}
+				word = word[:0]
+			}
+
+			word = append(word, r)
+			current.End = i + 1
+			continue
+		}
+
+		if current != nil && !isApostrophe(r) {
+			tokens = appendToken(tokens, current, string(word))
+			current = nil
+		}
+	}
+
+	if current != nil {
+		tokens = appendToken(tokens, current, string(word))
+	}
+
+	return tokens
+}
+
+// appendToken normalizes the word of a token, a word that transliterates to several parts stays one token
+func appendToken(tokens []*Token, token *Token, word string) []*Token {
+	token.Text = strings.ReplaceAll(TermKey(word), " ", "")
+	if token.Text == "" {
+		return tokens
+	}
+
+	return append(tokens, token)
+}
+
+func isApostrophe(r rune) bool {
+	switch r {
+	case '\'', '’', 'ʼ', '`':
+		return true
+	default:
+		return false
+	}
+}
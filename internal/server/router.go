@@ -4,6 +4,7 @@ import (
 	"github.com/ariefro/buycut-api/internal/brand"
 	"github.com/ariefro/buycut-api/internal/company"
 	"github.com/ariefro/buycut-api/internal/middleware"
+	"github.com/ariefro/buycut-api/internal/search"
 	"github.com/ariefro/buycut-api/internal/user"
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,6 +14,7 @@ func setupRouter(
 	userController user.Controller,
 	companyController company.Controller,
 	brandController brand.Controller,
+	searchController search.Controller,
 ) {
 	api := app.Group("/api/v1")
 
@@ -28,13 +30,35 @@ func setupRouter(
 	companiesApi.Put("/", middleware.Auth(), companyController.Update)
 	companiesApi.Get("/:id", companyController.FindOneByID)
 	companiesApi.Delete("/:id", middleware.Auth(), companyController.Delete)
+	companiesApi.Post("/:id/image/presign", middleware.Auth(), companyController.PresignImageUpload)
+	companiesApi.Post("/:id/image/finalize", middleware.Auth(), companyController.FinalizeImageUpload)
 
 	// brands
 	brandsApi := api.Group("/brands")
 	brandsApi.Post("/", middleware.Auth(), brandController.Create)
+	brandsApi.Get("/", brandController.Find)
+	brandsApi.Get("/boycotted", searchController.Cacheable, brandController.FindAll)
+	brandsApi.Get("/search", searchController.Cacheable, brandController.FindByKeyword)
+	brandsApi.Get("/:id", brandController.FindOneByID)
 	brandsApi.Put("/:id", middleware.Auth(), brandController.Update)
 	brandsApi.Delete("/:id", middleware.Auth(), brandController.Delete)
+	brandsApi.Post("/:id/image/presign", middleware.Auth(), brandController.PresignImageUpload)
+	brandsApi.Post("/:id/image/finalize", middleware.Auth(), brandController.FinalizeImageUpload)
+	brandsApi.Get("/:id/owners", brandController.FindOwnerships)
+	brandsApi.Post("/:id/owners", middleware.Auth(), brandController.CreateOwnership)
+	brandsApi.Put("/:id/owners/:ownershipId", middleware.Auth(), brandController.UpdateOwnership)
+	brandsApi.Delete("/:id/owners/:ownershipId", middleware.Auth(), brandController.DeleteOwnership)
 
 	brandsApi.Post("/boycotted", brandController.FindAll)
 	brandsApi.Post("/search", brandController.FindByKeyword)
+
+	// search
+	api.Get("/suggest", searchController.Suggest)
+
+	analyticsApi := api.Group("/search/analytics")
+	analyticsApi.Get("/top", middleware.Auth(), searchController.TopQueries)
+	analyticsApi.Get("/zero-results", middleware.Auth(), searchController.ZeroResultQueries)
+	analyticsApi.Get("/trends", middleware.Auth(), searchController.Trends)
+	api.Post("/lookup/batch", brandController.LookupBatch)
+	api.Post("/scan", brandController.Scan)
 }
@@ -1,10 +1,19 @@
 package server
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/ariefro/buycut-api/config"
+	"github.com/ariefro/buycut-api/internal/asset"
 	"github.com/ariefro/buycut-api/internal/brand"
+	"github.com/ariefro/buycut-api/internal/cloudstorage"
 	"github.com/ariefro/buycut-api/internal/company"
 	"github.com/ariefro/buycut-api/internal/middleware"
+	"github.com/ariefro/buycut-api/internal/search"
 	"github.com/ariefro/buycut-api/internal/user"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -12,24 +21,65 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// shutdownTimeout bounds how long the server waits for requests in flight and queued work on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func NewFiberServer(
 	config *config.Config,
 	userController user.Controller,
 	companyController company.Controller,
 	brandController brand.Controller,
+	searchController search.Controller,
+	searchService search.Service,
+	assetService asset.Service,
 ) error {
 	log.Println("starting server...")
 	app := fiber.New()
 	app.Use(recover.New())
 	app.Use(middleware.ConfigureCORS(config.ClientBaseURL))
+	app.Use(middleware.RequestTimeout(config.RequestTimeout))
+
+	// images kept by the local storage driver are served by the API itself
+	if config.StorageDriver == cloudstorage.DriverLocal {
+		app.Static(cloudstorage.LocalMountPath(config), config.LocalStorageDir, fiber.Static{
+			// an SVG opened on its own must not run anything, even if it slipped past sanitizing
+			ModifyResponse: func(c *fiber.Ctx) error {
+				c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; style-src 'unsafe-inline'; img-src data:")
+				return nil
+			},
+		})
+	}
 
 	setupRouter(
 		app,
 		userController,
 		companyController,
 		brandController,
+		searchController,
 	)
 
+	if err := asset.ScheduleReconcile(config.AssetReconcileCron, assetService); err != nil {
+		return err
+	}
+
+	// stop taking requests on SIGINT or SIGTERM, then write the searches still waiting to be recorded
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Println("shutting down server...")
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			log.Errorln("failed to shut down server:", err)
+		}
+	}()
+
 	log.Printf("🚀 listening on %s", config.AppPort)
-	return app.Listen(":" + config.AppPort)
+	if err := app.Listen(":" + config.AppPort); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return searchService.Close(ctx)
 }
@@ -49,7 +49,7 @@ func (ctrl *controller) Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	if err := ctrl.service.Register(c.Context(), &req); err != nil {
+	if err := ctrl.service.Register(c.UserContext(), &req); err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
@@ -69,12 +69,12 @@ func (ctrl *controller) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(response)
 	}
 
-	user, err := ctrl.service.FindOneByEmail(c.Context(), req.Email)
+	user, err := ctrl.service.FindOneByEmail(c.UserContext(), req.Email)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
 
-	accessToken, err := ctrl.service.Login(c.Context(), &req, user)
+	accessToken, err := ctrl.service.Login(c.UserContext(), &req, user)
 	if err != nil {
 		return helper.GenerateErrorResponse(c, err.Error())
 	}
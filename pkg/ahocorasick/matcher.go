@@ -0,0 +1,101 @@
+package ahocorasick
+
+// Matcher finds every occurrence of a set of patterns in a single pass over the input.
+// Patterns and inputs are sequences of words, so a match always starts and ends on a word boundary.
+type Matcher struct {
+	nodes    []node
+	patterns [][]string
+}
+
+type node struct {
+	next map[string]int
+	fail int
+	// out holds the patterns ending at this node, including those reached through fail links
+	out []int
+}
+
+// Match is an occurrence of a pattern spanning the words [Start, End) of the input
+type Match struct {
+	Pattern int
+	Start   int
+	End     int
+}
+
+// New builds the automaton of the given patterns, a match refers to a pattern by its index in the slice
+func New(patterns [][]string) *Matcher {
+	m := &Matcher{nodes: []node{{next: map[string]int{}}}, patterns: patterns}
+	for i, pattern := range patterns {
+		if len(pattern) == 0 {
+			continue
+		}
+
+		current := 0
+		for _, word := range pattern {
+			next, ok := m.nodes[current].next[word]
+			if !ok {
+				next = len(m.nodes)
+				m.nodes = append(m.nodes, node{next: map[string]int{}})
+				m.nodes[current].next[word] = next
+			}
+
+			current = next
+		}
+
+		m.nodes[current].out = append(m.nodes[current].out, i)
+	}
+
+	// link every node to the longest proper suffix of its path that is also in the trie, breadth first
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for word, child := range m.nodes[current].next {
+			fail := m.nodes[current].fail
+			for fail != 0 && !m.hasEdge(fail, word) {
+				fail = m.nodes[fail].fail
+			}
+
+			if next, ok := m.nodes[fail].next[word]; ok && next != child {
+				m.nodes[child].fail = next
+			}
+
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[m.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+
+	return m
+}
+
+// Len returns the number of patterns the matcher was built from
+func (m *Matcher) Len() int {
+	return len(m.patterns)
+}
+
+// Match returns every occurrence of the patterns in the words, ordered by where they end
+func (m *Matcher) Match(words []string) []Match {
+	var matches []Match
+	current := 0
+	for i, word := range words {
+		for current != 0 && !m.hasEdge(current, word) {
+			current = m.nodes[current].fail
+		}
+
+		current = m.nodes[current].next[word]
+		for _, pattern := range m.nodes[current].out {
+			matches = append(matches, Match{Pattern: pattern, Start: i + 1 - len(m.patterns[pattern]), End: i + 1})
+		}
+	}
+
+	return matches
+}
+
+func (m *Matcher) hasEdge(node int, word string) bool {
+	_, ok := m.nodes[node].next[word]
+	return ok
+}
@@ -8,8 +8,36 @@ const (
 	CompanyNotFound = "Perusahaan tidak terdaftar"
 	BrandNotFound   = "Merek tidak ditemukan dalam daftar boikot"
 
-	InvalidImageFile   = "file gambar tidak valid"
-	FileSizeIsTooLarge = "ukuran file seharusnya tidak melebihi 1 MB"
+	InvalidOwnershipRole        = "peran kepemilikan tidak valid"
+	InvalidOwnershipStake       = "persentase kepemilikan harus di antara 0 dan 100"
+	PrimaryOwnerCannotBeRemoved = "perusahaan pemilik utama tidak dapat dihapus dari merek"
+	PrimaryOwnerCannotBeChanged = "perusahaan atau tanggal berakhir pemilik utama hanya dapat diubah dengan memperbarui merek"
+	OwnershipNotFound           = "data kepemilikan merek tidak ditemukan"
+	InvalidOwnershipPeriod      = "tanggal berakhir kepemilikan harus setelah tanggal mulai"
+	InvalidDate                 = "format tanggal tidak valid, gunakan YYYY-MM-DD"
+	InvalidSortField            = "kolom pengurutan tidak valid"
+	InvalidCursor               = "cursor halaman tidak valid"
+	InvalidBarcodePrefix        = "prefiks barcode hanya boleh berisi 6 sampai 12 angka"
+	InvalidLookupItems          = "masukkan 1 sampai 300 item untuk diperiksa"
+	ScanTextTooLong             = "teks terlalu panjang, maksimal 10000 karakter"
+	InvalidCountryCode          = "kode negara harus berupa 2 huruf sesuai ISO 3166-1"
+	InvalidSearchFilter         = "filter pencarian tidak valid"
+	InvalidTrendInterval        = "interval harus salah satu dari day, week atau month"
+
+	InvalidImageFile        = "file gambar tidak valid"
+	FileSizeIsTooLarge      = "ukuran file gambar melebihi batas yang diizinkan"
+	ImageFormatNotSupported = "format gambar tidak didukung, gunakan JPEG, PNG, WebP atau SVG"
+	ImageDimensionsTooLarge = "lebar atau tinggi gambar melebihi batas yang diizinkan"
+	ImageTooManyPixels      = "resolusi gambar terlalu besar untuk diproses"
+	InvalidSVGFile          = "file SVG tidak valid"
+
+	DirectUploadNotSupported = "penyimpanan yang digunakan tidak mendukung unggahan langsung"
+	UploadedImageNotFound    = "gambar yang diunggah tidak ditemukan, unggah gambar terlebih dahulu"
+	InvalidImageSourceURL    = "alamat gambar harus berupa URL http atau https yang valid"
+	ImageSourceNotAllowed    = "alamat gambar tidak diizinkan"
+	ImageSourceUnreachable   = "gagal mengunduh gambar dari alamat tersebut"
+
+	RequestTimedOut = "permintaan terlalu lama diproses, silakan coba lagi"
 
 	MissingJWT = "Missing or malformed JWT"
 )
@@ -1,10 +1,23 @@
 package common
 
 const (
-	ColumnCompanyID   = "company_id"
-	ColumnDescription = "description"
-	ColumnImageURL    = "image_url"
-	ColumnName        = "name"
-	ColumnProof       = "proof"
-	ColumnSlug        = "slug"
+	ColumnAliases         = "aliases"
+	ColumnBarcodePrefixes = "barcode_prefixes"
+	ColumnBrandID         = "brand_id"
+	ColumnCategory        = "category"
+	ColumnCompanyID       = "company_id"
+	ColumnCountry         = "country"
+	ColumnCreatedAt       = "created_at"
+	ColumnDescription     = "description"
+	ColumnDomains         = "domains"
+	ColumnEndedAt         = "ended_at"
+	ColumnImageMissing    = "image_missing"
+	ColumnImages          = "images"
+	ColumnName            = "name"
+	ColumnProof           = "proof"
+	ColumnRole            = "role"
+	ColumnSlug            = "slug"
+	ColumnSourceURL       = "source_url"
+	ColumnStake           = "stake"
+	ColumnStartedAt       = "started_at"
 )
@@ -1,6 +1,11 @@
 package helper
 
-import "strconv"
+import (
+	"strconv"
+	"time"
+)
+
+const DateLayout = "2006-01-02"
 
 func ParseStringToUint(input string) uint {
 	result, err := strconv.ParseUint(input, 10, 64)
@@ -10,3 +15,7 @@ func ParseStringToUint(input string) uint {
 
 	return uint(result)
 }
+
+func ParseDate(input string) (time.Time, error) {
+	return time.Parse(DateLayout, input)
+}
@@ -1,6 +1,8 @@
 package helper
 
 import (
+	"context"
+
 	"github.com/ariefro/buycut-api/pkg/common"
 	"github.com/gofiber/fiber/v2"
 	log "github.com/sirupsen/logrus"
@@ -11,14 +13,49 @@ func GenerateErrorResponse(c *fiber.Ctx, errorMessage string) error {
 	var statusCode int
 
 	switch errorMessage {
-	case common.ErrInvalidEmailOrPassword:
+	case common.ErrInvalidEmailOrPassword,
+		common.InvalidOwnershipRole,
+		common.InvalidOwnershipStake,
+		common.PrimaryOwnerCannotBeRemoved,
+		common.PrimaryOwnerCannotBeChanged,
+		common.InvalidOwnershipPeriod,
+		common.InvalidDate,
+		common.InvalidSortField,
+		common.InvalidCursor,
+		common.InvalidBarcodePrefix,
+		common.InvalidLookupItems,
+		common.ScanTextTooLong,
+		common.InvalidCountryCode,
+		common.InvalidSearchFilter,
+		common.InvalidTrendInterval,
+		common.InvalidImageFile,
+		common.InvalidSVGFile,
+		common.InvalidImageSourceURL,
+		common.ImageSourceNotAllowed:
 		statusCode = fiber.StatusBadRequest
+	case common.FileSizeIsTooLarge:
+		statusCode = fiber.StatusRequestEntityTooLarge
+	case common.ImageFormatNotSupported:
+		statusCode = fiber.StatusUnsupportedMediaType
+	case common.ImageDimensionsTooLarge,
+		common.ImageTooManyPixels:
+		statusCode = fiber.StatusUnprocessableEntity
 	case common.MissingJWT:
 		statusCode = fiber.StatusUnauthorized
 	case common.EmailNotRegistered,
 		common.CompanyNotFound,
-		common.BrandNotFound:
+		common.BrandNotFound,
+		common.OwnershipNotFound,
+		common.UploadedImageNotFound:
 		statusCode = fiber.StatusNotFound
+	case common.ImageSourceUnreachable:
+		statusCode = fiber.StatusUnprocessableEntity
+	case common.DirectUploadNotSupported:
+		statusCode = fiber.StatusNotImplemented
+	case common.RequestTimedOut,
+		context.DeadlineExceeded.Error():
+		statusCode = fiber.StatusGatewayTimeout
+		errorMessage = common.RequestTimedOut
 	case common.ErrDuplicateEntry,
 		gorm.ErrDuplicatedKey.Error():
 		statusCode = fiber.StatusConflict
@@ -12,6 +12,18 @@ func ResponseFailed(message string) baseResponseFailed {
 	}
 }
 
+type baseResponseFailedWithSuggestion struct {
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+func ResponseFailedWithSuggestion(message, suggestion string) baseResponseFailedWithSuggestion {
+	return baseResponseFailedWithSuggestion{
+		Message:    message,
+		Suggestion: suggestion,
+	}
+}
+
 type baseResponseSuccess struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
@@ -30,6 +42,27 @@ type baseResponseSuccessWithPagination struct {
 	Data    interface{}       `json:"data"`
 }
 
+type baseResponseSuccessWithFacets struct {
+	Message string            `json:"message"`
+	Pages   *pagination.Pages `json:"page"`
+	Facets  interface{}       `json:"facets"`
+	Data    interface{}       `json:"data"`
+}
+
+type baseResponseSuccessWithCursor struct {
+	Message string                  `json:"message"`
+	Pages   *pagination.CursorPages `json:"page"`
+	Data    interface{}             `json:"data"`
+}
+
+func ResponseSuccessWithCursor(message string, data interface{}, pages *pagination.CursorPages) baseResponseSuccessWithCursor {
+	return baseResponseSuccessWithCursor{
+		Message: message,
+		Pages:   pages,
+		Data:    data,
+	}
+}
+
 func ResponseSuccessWithPagination(message string, data interface{}, pages *pagination.Pages) baseResponseSuccessWithPagination {
 	return baseResponseSuccessWithPagination{
 		Message: message,
@@ -37,3 +70,12 @@ func ResponseSuccessWithPagination(message string, data interface{}, pages *pagi
 		Data:    data,
 	}
 }
+
+func ResponseSuccessWithFacets(message string, data interface{}, pages *pagination.Pages, facets interface{}) baseResponseSuccessWithFacets {
+	return baseResponseSuccessWithFacets{
+		Message: message,
+		Pages:   pages,
+		Facets:  facets,
+		Data:    data,
+	}
+}
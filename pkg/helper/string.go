@@ -1,6 +1,8 @@
 package helper
 
 import (
+	"strings"
+
 	"github.com/gosimple/slug"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -13,3 +15,111 @@ func GenerateSlug(input string) string {
 func MakeTitle(input string) string {
 	return cases.Title(language.English).String(input)
 }
+
+// NormalizeSearchKey folds a name into the form it is searched by: transliterated to ASCII, lower case,
+// without apostrophes and with other punctuation turned into single spaces, e.g. "L'Oréal Paris" becomes "loreal paris".
+// The slug package spells "&" and "@" out in English, they are turned into spaces first so "H&M" is
+// found as "H M" rather than only as "handm". A name spelled with "and" is still a different key.
+func NormalizeSearchKey(input string) string {
+	return strings.ReplaceAll(slug.Make(searchKeySymbols.Replace(input)), "-", " ")
+}
+
+var searchKeySymbols = strings.NewReplacer("&", " ", "@", " ")
+
+// EscapeLike escapes the wildcard characters of a LIKE pattern
+func EscapeLike(input string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(input)
+}
+
+// NormalizeDomain reduces a domain or URL to its lower case host without "www.", e.g. "https://www.Example.com/a" becomes "example.com"
+func NormalizeDomain(input string) string {
+	host := strings.ToLower(strings.TrimSpace(input))
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+
+	if i := strings.Index(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+
+	return strings.TrimPrefix(strings.Trim(host, "."), "www.")
+}
+
+// NormalizeDomains normalizes every domain and drops the blank ones
+func NormalizeDomains(inputs []string) []string {
+	domains := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		if domain := NormalizeDomain(input); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	return domains
+}
+
+// CompactStrings trims every input and drops the blank ones, it never returns nil
+func CompactStrings(inputs []string) []string {
+	outputs := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		if output := strings.TrimSpace(input); output != "" {
+			outputs = append(outputs, output)
+		}
+	}
+
+	return outputs
+}
+
+// DomainSuffixes returns the domain followed by its parent domains, down to the last two labels
+func DomainSuffixes(domain string) []string {
+	suffixes := []string{domain}
+	for strings.Count(domain, ".") > 1 {
+		domain = domain[strings.Index(domain, ".")+1:]
+		suffixes = append(suffixes, domain)
+	}
+
+	return suffixes
+}
+
+// IsDigits reports whether the input is made of decimal digits only
+func IsDigits(input string) bool {
+	if input == "" {
+		return false
+	}
+
+	for _, r := range input {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NormalizeBarcode converts an EAN-8, UPC-A, EAN-13 or GTIN-14 code to the digits its GS1 company prefix is read from.
+// Spaces and dashes are ignored, ok is false when the input is not a barcode.
+func NormalizeBarcode(input string) (code string, ok bool) {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(input)
+	if !IsDigits(code) {
+		return "", false
+	}
+
+	switch len(code) {
+	case 8, 13:
+		return code, true
+	case 12:
+		return "0" + code, true
+	case 14:
+		// the first digit is the packaging indicator
+		return code[1:], true
+	default:
+		return "", false
+	}
+}
@@ -1,47 +1,99 @@
 package helper
 
 import (
+	"bytes"
 	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"mime/multipart"
-	"path/filepath"
-	"strings"
+	"net/http"
 
+	"github.com/ariefro/buycut-api/config"
 	"github.com/ariefro/buycut-api/pkg/common"
+	"github.com/ariefro/buycut-api/pkg/imaging"
+	_ "golang.org/x/image/webp"
 )
 
-func ValidateImage(file *multipart.FileHeader) error {
-	// Check for supported image extensions
-	if err := validateImageExtension(file.Filename); err != nil {
+// imageFormats maps the content types accepted for uploads to the format name image.Decode reports
+var imageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
 
+// ValidateImage checks the content of an uploaded image rather than its name: the magic bytes must
+// be of a supported format, the header must stay within the limits and the whole image must decode.
+// An SVG has no pixels to count, it only has to stay within the size limit and survive sanitizing.
+func ValidateImage(file *multipart.FileHeader, limits *config.ImageLimits) error {
+	maxSize := int64(limits.MaxSizeKB) * 1024
+	if err := validateFileSize(file.Size, maxSize); err != nil {
 		return err
 	}
 
-	// Check for maximum file size
-	if err := validateFileSize(file.Size); err != nil {
+	f, err := file.Open()
+	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	return nil
+	// the header size may lie, never read more than the limit allows
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return err
+	}
+
+	return ValidateImageData(data, limits)
 }
 
-func validateImageExtension(filename string) error {
-	validExtensions := map[string]struct{}{
-		".jpg":  {},
-		".jpeg": {},
-		".png":  {},
-		".webp": {},
+// ValidateImageData runs the checks of ValidateImage on an image already read into memory
+func ValidateImageData(data []byte, limits *config.ImageLimits) error {
+	if err := validateFileSize(int64(len(data)), int64(limits.MaxSizeKB)*1024); err != nil {
+		return err
+	}
+
+	if imaging.IsSVG(data) {
+		if _, err := imaging.SanitizeSVG(data); err != nil {
+			return errors.New(common.InvalidSVGFile)
+		}
+
+		return nil
+	}
+
+	format, ok := imageFormats[http.DetectContentType(data)]
+	if !ok {
+		return errors.New(common.ImageFormatNotSupported)
+	}
+
+	cfg, configFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || configFormat != format {
+		return errors.New(common.InvalidImageFile)
+	}
+
+	if uint64(cfg.Width)*uint64(cfg.Height) > uint64(limits.MaxPixels) {
+		return errors.New(common.ImageTooManyPixels)
+	}
+
+	if uint(cfg.Width) > limits.MaxWidth || uint(cfg.Height) > limits.MaxHeight {
+		return errors.New(common.ImageDimensionsTooLarge)
+	}
+
+	// a valid header says nothing about the rest of the file, decode it completely
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errors.New(common.InvalidImageFile)
 	}
 
-	ext := strings.ToLower(filepath.Ext(filename))
-	if _, ok := validExtensions[ext]; !ok {
+	if bounds := img.Bounds(); bounds.Dx() != cfg.Width || bounds.Dy() != cfg.Height {
 		return errors.New(common.InvalidImageFile)
 	}
 
 	return nil
 }
 
-func validateFileSize(size int64) error {
-	if size > 1*1024*1024 { // 1 MB limit
+func validateFileSize(size, maxSize int64) error {
+	if size > maxSize {
 		return errors.New(common.FileSizeIsTooLarge)
 	}
 
@@ -0,0 +1,86 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Variant is an encoded rendition of an image that fits in a Size by Size box
+type Variant struct {
+	Size uint
+	Data []byte
+}
+
+// jpegQuality is used for the variants of photographs, which lossless WebP would make heavier than the upload
+const jpegQuality = 85
+
+// Process decodes an image, turns it upright according to its EXIF orientation and encodes one
+// WebP variant per size. Re-encoding drops every metadata of the original, EXIF included.
+// Images are scaled down to fit the sizes but never scaled up.
+//
+// The WebP encoder is lossless only, which suits logos but can make a photograph several times
+// heavier than the JPEG it came from. A variant of an opaque image that outweighs the upload is
+// encoded as JPEG instead when that is lighter. Transparent images stay lossless, so their
+// variants may still be larger than the upload.
+func Process(data []byte, sizes []uint) ([]*Variant, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img = orient(img, exifOrientation(data))
+
+	variants := make([]*Variant, 0, len(sizes))
+	for _, size := range sizes {
+		variant := fit(img, int(size))
+
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, variant, nil); err != nil {
+			return nil, err
+		}
+
+		encoded := buf.Bytes()
+		if len(encoded) > len(data) && variant.Opaque() {
+			var jpegBuf bytes.Buffer
+			if err := jpeg.Encode(&jpegBuf, variant, &jpeg.Options{Quality: jpegQuality}); err != nil {
+				return nil, err
+			}
+
+			if jpegBuf.Len() < len(encoded) {
+				encoded = jpegBuf.Bytes()
+			}
+		}
+
+		variants = append(variants, &Variant{Size: size, Data: encoded})
+	}
+
+	return variants, nil
+}
+
+// fit scales the image down to fit in a size by size box, keeping its aspect ratio
+func fit(img image.Image, size int) *image.NRGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+		return dst
+	}
+
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, max(dw, 1), max(dh, 1)))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	return dst
+}
@@ -0,0 +1,57 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// RasterizeSVG renders a sanitized SVG into one PNG variant per size. Unlike bitmaps, an SVG is
+// scaled up as well as down, so every variant fills its box along the longer side of the view box.
+func RasterizeSVG(data []byte, sizes []uint) (variants []*Variant, err error) {
+	// the renderer panics on some malformed paths, an upload must not take the server down
+	defer func() {
+		if r := recover(); r != nil {
+			variants, err = nil, fmt.Errorf("rasterize svg: %v", r)
+		}
+	}()
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := icon.ViewBox.W, icon.ViewBox.H
+	if !(w > 0 && h > 0) || math.IsInf(w, 0) || math.IsInf(h, 0) {
+		return nil, ErrInvalidSVG
+	}
+
+	variants = make([]*Variant, 0, len(sizes))
+	for _, size := range sizes {
+		dw, dh := float64(size), h*float64(size)/w
+		if h > w {
+			dw, dh = w*float64(size)/h, float64(size)
+		}
+
+		width, height := max(int(math.Round(dw)), 1), max(int(math.Round(dh)), 1)
+		icon.SetTarget(0, 0, float64(width), float64(height))
+
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+		icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, &Variant{Size: size, Data: buf.Bytes()})
+	}
+
+	return variants, nil
+}
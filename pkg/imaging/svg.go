@@ -0,0 +1,304 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+
+	// maxSVGElements and maxSVGDepth bound the work a small file can cause once it is rendered
+	maxSVGElements = 20000
+	maxSVGDepth    = 64
+)
+
+var ErrInvalidSVG = errors.New("invalid svg")
+
+// svgElements are the elements kept by SanitizeSVG, they can only draw. Scripts, foreign objects,
+// animations and anything that loads another document are left out.
+var svgElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true, "title": true, "desc": true, "switch": true,
+	"path": true, "rect": true, "circle": true, "ellipse": true, "line": true, "polyline": true, "polygon": true,
+	"text": true, "tspan": true, "textPath": true, "image": true, "style": true,
+	"linearGradient": true, "radialGradient": true, "stop": true, "pattern": true,
+	"clipPath": true, "mask": true, "marker": true,
+	"filter": true, "feBlend": true, "feColorMatrix": true, "feComponentTransfer": true, "feComposite": true,
+	"feDropShadow": true, "feFlood": true, "feFuncA": true, "feFuncB": true, "feFuncG": true, "feFuncR": true,
+	"feGaussianBlur": true, "feMerge": true, "feMergeNode": true, "feMorphology": true, "feOffset": true,
+}
+
+// svgUnwrapped are dropped while their children are kept, a logo wrapped in a link still draws
+var svgUnwrapped = map[string]bool{
+	"a": true,
+}
+
+// svgTextEscaper escapes text content, unlike xml.EscapeText it leaves line breaks alone
+var svgTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// IsSVG reports whether the data is an XML document whose root element is an svg
+func IsSVG(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return false
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			return t.Name.Local == "svg"
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return false
+			}
+		}
+	}
+}
+
+// SanitizeSVG rewrites an SVG keeping only what draws it: elements outside of svgElements, event
+// handlers, references to anything but a fragment of the document itself, style sheets that reach
+// outside of it, comments, processing instructions and the DOCTYPE are removed. Entities the
+// document declares are not expanded, a document that uses them is rejected.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	s := &svgSanitizer{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, ErrInvalidSVG
+		}
+
+		if err := s.write(token); err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.root || s.depth != 0 {
+		return nil, ErrInvalidSVG
+	}
+
+	return s.out.Bytes(), nil
+}
+
+type svgSanitizer struct {
+	out      bytes.Buffer
+	root     bool
+	depth    int
+	elements int
+	// skip is the depth of the element being dropped along with its children, 0 when none is
+	skip int
+	// unwrapped are the depths of the elements dropped without their children
+	unwrapped []int
+	// open is true while the start tag written last still waits for its closing bracket
+	open bool
+	// style collects the text of a style element until its end, the sheet is kept only when it is safe
+	style *bytes.Buffer
+}
+
+func (s *svgSanitizer) write(token xml.Token) error {
+	switch t := token.(type) {
+	case xml.StartElement:
+		s.depth++
+		s.elements++
+		if s.depth > maxSVGDepth || s.elements > maxSVGElements {
+			return ErrInvalidSVG
+		}
+
+		if !s.root {
+			if !isSVGName(t.Name) || t.Name.Local != "svg" {
+				return ErrInvalidSVG
+			}
+
+			s.root = true
+		}
+
+		if s.skip > 0 {
+			return nil
+		}
+
+		if isSVGName(t.Name) && svgUnwrapped[t.Name.Local] {
+			s.unwrapped = append(s.unwrapped, s.depth)
+			return nil
+		}
+
+		if !isSVGName(t.Name) || !svgElements[t.Name.Local] || s.style != nil {
+			s.skip = s.depth
+			return nil
+		}
+
+		s.startTag(t)
+		if t.Name.Local == "style" {
+			s.style = &bytes.Buffer{}
+		}
+	case xml.EndElement:
+		defer func() { s.depth-- }()
+
+		if s.skip > 0 {
+			if s.skip == s.depth {
+				s.skip = 0
+			}
+
+			return nil
+		}
+
+		if n := len(s.unwrapped); n > 0 && s.unwrapped[n-1] == s.depth {
+			s.unwrapped = s.unwrapped[:n-1]
+			return nil
+		}
+
+		if s.style != nil {
+			if css := s.style.String(); isSafeCSS(css) {
+				s.closeStartTag()
+				svgTextEscaper.WriteString(&s.out, css)
+			}
+
+			s.style = nil
+		}
+
+		if s.open {
+			s.out.WriteString("/>")
+			s.open = false
+			return nil
+		}
+
+		s.out.WriteString("</" + t.Name.Local + ">")
+	case xml.CharData:
+		if s.skip > 0 || s.depth == 0 {
+			return nil
+		}
+
+		if s.style != nil {
+			s.style.Write(t)
+			return nil
+		}
+
+		s.closeStartTag()
+		svgTextEscaper.WriteString(&s.out, string(t))
+	}
+
+	// comments, processing instructions and directives are dropped
+	return nil
+}
+
+func (s *svgSanitizer) startTag(t xml.StartElement) {
+	s.closeStartTag()
+
+	s.out.WriteString("<" + t.Name.Local)
+	if s.depth == 1 {
+		s.writeAttr("xmlns", svgNamespace)
+		s.writeAttr("xmlns:xlink", xlinkNamespace)
+	}
+
+	for _, attr := range t.Attr {
+		if name, ok := svgAttrName(t.Name.Local, attr); ok {
+			s.writeAttr(name, attr.Value)
+		}
+	}
+
+	s.open = true
+}
+
+func (s *svgSanitizer) closeStartTag() {
+	if s.open {
+		s.out.WriteString(">")
+		s.open = false
+	}
+}
+
+func (s *svgSanitizer) writeAttr(name, value string) {
+	s.out.WriteString(" " + name + `="`)
+	xml.EscapeText(&s.out, []byte(value))
+	s.out.WriteString(`"`)
+}
+
+// svgAttrName returns the name an attribute is written with, false when it has to be dropped
+func svgAttrName(element string, attr xml.Attr) (string, bool) {
+	name := strings.ToLower(attr.Name.Local)
+	switch attr.Name.Space {
+	case "":
+		// namespace declarations are written again on the root, event handlers never are
+		if name == "xmlns" || strings.HasPrefix(name, "on") {
+			return "", false
+		}
+
+		if name == "href" {
+			return attr.Name.Local, isSafeHref(element, attr.Value)
+		}
+
+		if name == "style" {
+			return attr.Name.Local, isSafeCSS(attr.Value)
+		}
+
+		// presentation attributes take the same values as their CSS properties
+		return attr.Name.Local, isSafeCSS(attr.Value)
+	case xlinkNamespace:
+		return "xlink:" + attr.Name.Local, name == "href" && isSafeHref(element, attr.Value)
+	case xmlNamespace, "xml":
+		return "xml:" + attr.Name.Local, name == "space" || name == "lang"
+	}
+
+	return "", false
+}
+
+// isSafeHref allows references to a fragment of the document, and to an inline bitmap on an image
+func isSafeHref(element, value string) bool {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "#") {
+		return true
+	}
+
+	if element != "image" {
+		return false
+	}
+
+	value = strings.ToLower(value)
+	for _, prefix := range []string{"data:image/png;base64,", "data:image/jpeg;base64,", "data:image/webp;base64,"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSafeCSS turns away style sheets that import others, run code or point url() outside of the
+// document. image-set(), image() and src() load a URL given as a plain string, so they are turned
+// away whatever they point at. CSS escapes could spell any of those, so a sheet with a backslash
+// is turned away too.
+func isSafeCSS(css string) bool {
+	css = strings.ToLower(css)
+	for _, unsafe := range []string{"\\", "@import", "expression(", "javascript:", "-moz-binding", "behavior:", "image-set(", "image(", "src("} {
+		if strings.Contains(css, unsafe) {
+			return false
+		}
+	}
+
+	for rest := css; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return true
+		}
+
+		rest = rest[i+len("url("):]
+		ref := strings.Trim(strings.TrimSpace(rest), `'"`)
+		if !strings.HasPrefix(ref, "#") {
+			return false
+		}
+	}
+}
+
+func isSVGName(name xml.Name) bool {
+	return name.Space == svgNamespace || name.Space == ""
+}
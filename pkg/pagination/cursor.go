@@ -0,0 +1,191 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ariefro/buycut-api/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	// ModeVar specifies the query parameter name for the pagination mode
+	ModeVar = "pagination"
+	// CursorVar specifies the query parameter name for the page cursor
+	CursorVar = "cursor"
+	// ModeCursor is the ModeVar value that turns on keyset pagination
+	ModeCursor = "cursor"
+
+	ErrInvalidCursor = errors.New(common.InvalidCursor)
+)
+
+// Cursor points at the row a page starts after, or before when it is a backward cursor.
+// Key holds the value of the sort column of that row and ID breaks ties. Sort names the order
+// the cursor was read in, a cursor only continues the list it came from.
+type Cursor struct {
+	Sort     string `json:"s"`
+	Key      string `json:"k"`
+	ID       uint   `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Encode returns the opaque form of the cursor sent to clients
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// Sort describes the column a keyset is ordered by, ties are broken by id. The keys of a
+// Timestamp column are written in RFC 3339.
+type Sort struct {
+	Column    string
+	Desc      bool
+	Timestamp bool
+}
+
+// Name identifies the sort in a cursor
+func (s Sort) Name() string {
+	if s.Desc {
+		return "-" + s.Column
+	}
+
+	return s.Column
+}
+
+// key returns the value a cursor key is compared with, false when it cannot be one of the column
+func (s Sort) key(cursor *Cursor) (interface{}, bool) {
+	if !s.Timestamp {
+		return cursor.Key, true
+	}
+
+	key, err := time.Parse(time.RFC3339Nano, cursor.Key)
+	return key, err == nil
+}
+
+// Order returns the ORDER BY clause, reversed when reading backward
+func (s Sort) Order(backward bool) string {
+	direction := "ASC"
+	if s.Desc != backward {
+		direction = "DESC"
+	}
+
+	return s.Column + " " + direction + ", id " + direction
+}
+
+// CursorPages represents the keyset pagination metadata of a list of data items
+type CursorPages struct {
+	Limit      int    `json:"perPage"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+type CursorParams struct {
+	Cursor *Cursor
+	Limit  int
+}
+
+// IsCursorRequest reports whether the request asks for keyset pagination
+func IsCursorRequest(c *fiber.Ctx) bool {
+	return c.Query(ModeVar) == ModeCursor || c.Query(CursorVar) != ""
+}
+
+// NewCursorFromRequest creates a CursorParams object using the query parameters found in the given HTTP request
+func NewCursorFromRequest(c *fiber.Ctx) (*CursorParams, error) {
+	limit := parseInt(c.Query(LimitVar), DefaultPageSize)
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	params := &CursorParams{Limit: limit}
+	if value := c.Query(CursorVar); value != "" {
+		cursor, err := DecodeCursor(value)
+		if err != nil {
+			return nil, err
+		}
+
+		params.Cursor = cursor
+	}
+
+	return params, nil
+}
+
+// Scope orders the query by the sort and reads one row past the page to find out whether more rows follow.
+// A cursor read in another order, or whose key does not fit the sort column, fails the query with ErrInvalidCursor.
+func (p *CursorParams) Scope(sort Sort) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		backward := p.Cursor != nil && p.Cursor.Backward
+		if p.Cursor != nil {
+			key, ok := sort.key(p.Cursor)
+			if !ok || p.Cursor.Sort != sort.Name() {
+				db.AddError(ErrInvalidCursor)
+				return db
+			}
+
+			operator := ">"
+			if sort.Desc != backward {
+				operator = "<"
+			}
+
+			db = db.Where("("+sort.Column+", id) "+operator+" (?, ?)", key, p.Cursor.ID)
+		}
+
+		return db.Order(sort.Order(backward)).Limit(p.Limit + 1)
+	}
+}
+
+// NewCursorPages trims the rows read with Scope to the page and builds its metadata.
+// The key function returns the sort column value and the id of a row.
+func NewCursorPages[T any](params *CursorParams, sort Sort, rows []T, key func(row T) (string, uint)) ([]T, *CursorPages) {
+	pages := &CursorPages{Limit: params.Limit}
+	backward := params.Cursor != nil && params.Cursor.Backward
+
+	hasMore := len(rows) > params.Limit
+	if hasMore {
+		rows = rows[:params.Limit]
+	}
+
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	if len(rows) == 0 {
+		return rows, pages
+	}
+
+	// a backward page always has the page it came from after it
+	if hasMore || backward {
+		k, id := key(rows[len(rows)-1])
+		pages.NextCursor = (&Cursor{Sort: sort.Name(), Key: k, ID: id}).Encode()
+	}
+
+	// a forward page past the first one always has a page before it
+	if (hasMore && backward) || (!backward && params.Cursor != nil) {
+		k, id := key(rows[0])
+		pages.PrevCursor = (&Cursor{Sort: sort.Name(), Key: k, ID: id, Backward: true}).Encode()
+	}
+
+	return rows, pages
+}